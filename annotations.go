@@ -0,0 +1,183 @@
+package source
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Annotation represents an annotation in the doc comment of a node
+// e.x `// @http method=GET path=/users` or a directive e.x `//go:generate mockgen`.
+type Annotation struct {
+	// the name of the annotation without `@` e.x `http`,
+	// directives are named with their prefix e.x `go:generate`
+	Name string
+
+	// true for directives e.x `//go:generate`
+	Directive bool
+
+	// the positional arguments e.x `a` and `b c` in `// @tag a "b c"`
+	Args []string
+
+	// the key=value arguments e.x `method` and `path` in `// @http method=GET path=/users`
+	Params map[string]string
+
+	Position token.Position
+}
+
+// Param returns the value of the key=value argument with the given key.
+func (a Annotation) Param(key string) (string, bool) {
+	v, ok := a.Params[key]
+	return v, ok
+}
+
+// hasAnnotation returns true if the annotations contain an annotation with the given name,
+// the name can be given with or without `@`.
+func hasAnnotation(annotations []Annotation, name string) bool {
+	name = strings.TrimPrefix(name, "@")
+	for _, a := range annotations {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAnnotations parses the annotations and directives in the doc comment.
+func parseAnnotations(docs *ast.CommentGroup, tokenFile *token.File) (annotations []Annotation) {
+	if docs == nil {
+		return
+	}
+	for _, c := range docs.List {
+		if c == nil {
+			continue
+		}
+		position := token.Position{}
+		if tokenFile != nil {
+			position = tokenFile.Position(c.Pos())
+		}
+		if name, args, ok := parseDirective(c.Text); ok {
+			a := newAnnotation(name, args, position)
+			a.Directive = true
+			annotations = append(annotations, a)
+			continue
+		}
+		// block comments can have an annotation on every line
+		for _, line := range strings.Split(cleanComment(c.Text), "\n") {
+			line = strings.TrimLeft(strings.TrimSpace(line), "* ")
+			if !strings.HasPrefix(line, "@") {
+				continue
+			}
+			name := line[1:]
+			args := ""
+			if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+				name, args = name[:i], name[i+1:]
+			}
+			if name == "" {
+				continue
+			}
+			annotations = append(annotations, newAnnotation(name, args, position))
+		}
+	}
+	return
+}
+
+// parseDirective parses directives e.x `//go:generate mockgen`, a directive is a line comment
+// without a space after `//` that starts with a lowercase prefix followed by `:`.
+func parseDirective(comment string) (name, args string, ok bool) {
+	if !strings.HasPrefix(comment, "//") {
+		return "", "", false
+	}
+	text := comment[2:]
+	colon := strings.Index(text, ":")
+	if colon <= 0 || colon == len(text)-1 {
+		return "", "", false
+	}
+	for _, r := range text[:colon] {
+		if !unicode.IsLower(r) && !unicode.IsDigit(r) {
+			return "", "", false
+		}
+	}
+	if !unicode.IsLetter(rune(text[colon+1])) {
+		return "", "", false
+	}
+	name = text
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		name, args = text[:i], text[i+1:]
+	}
+	return name, args, true
+}
+
+func newAnnotation(name, args string, position token.Position) Annotation {
+	a := Annotation{
+		Name:     name,
+		Params:   map[string]string{},
+		Position: position,
+	}
+	for _, arg := range splitArgs(args) {
+		if i := strings.Index(arg, "="); i > 0 && isParamKey(arg[:i]) {
+			a.Params[arg[:i]] = unquoteArg(arg[i+1:])
+			continue
+		}
+		a.Args = append(a.Args, unquoteArg(arg))
+	}
+	return a
+}
+
+// splitArgs splits the arguments on spaces, spaces inside quoted values are kept
+// e.x `a b="c d"` is split into `a` and `b="c d"`.
+func splitArgs(args string) (list []string) {
+	var current strings.Builder
+	var quote byte
+	for i := 0; i < len(args); i++ {
+		c := args[i]
+		switch {
+		case quote != 0:
+			current.WriteByte(c)
+			if c == '\\' && quote == '"' && i+1 < len(args) {
+				i++
+				current.WriteByte(args[i])
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+			current.WriteByte(c)
+		case c == ' ' || c == '\t':
+			if current.Len() > 0 {
+				list = append(list, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if current.Len() > 0 {
+		list = append(list, current.String())
+	}
+	return list
+}
+
+// isParamKey returns true if the key of a key=value argument is an identifier e.x `path` or `max-age`.
+func isParamKey(key string) bool {
+	for i, r := range key {
+		if unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.')) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// unquoteArg removes the quotes of quoted values, values that are not valid go strings are kept as is.
+func unquoteArg(arg string) string {
+	if len(arg) < 2 || (arg[0] != '"' && arg[0] != '`') {
+		return arg
+	}
+	if v, err := strconv.Unquote(arg); err == nil {
+		return v
+	}
+	return arg
+}
@@ -1,8 +1,15 @@
 package source
 
 import (
+	"fmt"
 	"go/build"
+	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 type ImportInfo struct {
@@ -35,3 +42,129 @@ func (d DefaultBuildContext) Cwd() (string, error) {
 	cwd, err := os.Getwd()
 	return cwd, err
 }
+
+// FileSystem is implemented by build contexts that serve the files of the packages e.x MapBuildContext,
+// packages are loaded from it instead of the disk.
+type FileSystem interface {
+	FileSystem() fs.FS
+}
+
+// MapBuildContext resolves imports from a map instead of the disk, it is used to load
+// packages without depending on the environment e.x in tests.
+type MapBuildContext struct {
+	// the packages by import path
+	Packages map[string]ImportInfo
+
+	// the working directory, defaults to `/`
+	Dir string
+
+	// the files of the packages, nil to read the files from the disk.
+	// Absolute paths are used without the leading `/` e.x `/app/main.go` is read as `app/main.go`
+	FS fs.FS
+}
+
+func (m MapBuildContext) Import(path string) (*ImportInfo, error) {
+	pkg, ok := m.Packages[path]
+	if !ok {
+		return nil, &NotFoundError{Kind: "package", Name: path}
+	}
+	return &pkg, nil
+}
+
+func (m MapBuildContext) Cwd() (string, error) {
+	if m.Dir == "" {
+		return string(filepath.Separator), nil
+	}
+	return m.Dir, nil
+}
+
+func (m MapBuildContext) FileSystem() fs.FS {
+	return m.FS
+}
+
+// fileSystem reads files from the file system of the build context or from the disk.
+type fileSystem struct {
+	fs fs.FS
+}
+
+func newFileSystem(buildContext BuildContext) fileSystem {
+	if f, ok := buildContext.(FileSystem); ok {
+		return fileSystem{fs: f.FileSystem()}
+	}
+	return fileSystem{}
+}
+
+// fsPath converts the path to a path of the file system e.x `/app/main.go` to `app/main.go`.
+func fsPath(pth string) string {
+	pth = strings.TrimPrefix(path.Clean(filepath.ToSlash(pth)), "/")
+	if pth == "" {
+		return "."
+	}
+	return pth
+}
+
+func (f fileSystem) isDir(dir string) bool {
+	if f.fs == nil {
+		info, err := os.Stat(dir)
+		return err == nil && info.IsDir()
+	}
+	info, err := fs.Stat(f.fs, fsPath(dir))
+	return err == nil && info.IsDir()
+}
+
+func (f fileSystem) readDir(dir string) ([]os.FileInfo, error) {
+	if f.fs == nil {
+		return ioutil.ReadDir(dir)
+	}
+	entries, err := fs.ReadDir(f.fs, fsPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (f fileSystem) readFile(name string) ([]byte, error) {
+	if f.fs == nil {
+		return ioutil.ReadFile(name)
+	}
+	return fs.ReadFile(f.fs, fsPath(name))
+}
+
+// buildContext returns a copy of ctx that reads files from the file system.
+func (f fileSystem) buildContext(ctx build.Context) build.Context {
+	if f.fs == nil {
+		return ctx
+	}
+	ctx.ReadDir = f.readDir
+	ctx.OpenFile = func(name string) (io.ReadCloser, error) {
+		return f.fs.Open(fsPath(name))
+	}
+	ctx.IsDir = f.isDir
+	return ctx
+}
+
+// findModule returns the module path and the directory of the nearest go.mod in dir or its parents.
+func findModule(dir string) (module, moduleDir string, err error) {
+	gomod, ok := findFile(dir, "go.mod")
+	if !ok {
+		return "", "", fmt.Errorf("no go.mod found in `%s` or its parents", dir)
+	}
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return "", "", err
+	}
+	for _, d := range parseModDirectives(string(data)) {
+		if d.verb == "module" {
+			return d.args[0], filepath.Dir(gomod), nil
+		}
+	}
+	return "", "", fmt.Errorf("no module path found in `%s`", gomod)
+}
@@ -0,0 +1,80 @@
+package source
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ImportCache caches the packages resolved by the build context so the imports are not resolved
+// again every time the source is parsed after an edit.
+// A cache can be shared by multiple sources using WithImportCache, the packages are cached for every
+// build context separately. Imports that can not be resolved are not cached.
+type ImportCache struct {
+	mu       sync.Mutex
+	contexts []contextImports
+	hits     int
+	misses   int
+}
+
+// contextImports holds the packages resolved by one build context.
+type contextImports struct {
+	buildContext BuildContext
+	packages     map[string]*ImportInfo
+}
+
+func NewImportCache() *ImportCache {
+	return &ImportCache{}
+}
+
+// Import returns the cached package of the import path, the build context is only used
+// the first time a path is imported.
+func (c *ImportCache) Import(buildContext BuildContext, path string) (*ImportInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	packages := c.packages(buildContext)
+	if info, ok := packages[path]; ok {
+		c.hits++
+		return info, nil
+	}
+	c.misses++
+	info, err := buildContext.Import(path)
+	if err != nil {
+		return nil, err
+	}
+	packages[path] = info
+	return info, nil
+}
+
+// packages returns the cached packages of the build context, the build contexts are compared
+// with reflect.DeepEqual because not every context is comparable e.x MapBuildContext.
+func (c *ImportCache) packages(buildContext BuildContext) map[string]*ImportInfo {
+	for _, ci := range c.contexts {
+		if reflect.DeepEqual(ci.buildContext, buildContext) {
+			return ci.packages
+		}
+	}
+	ci := contextImports{buildContext: buildContext, packages: map[string]*ImportInfo{}}
+	c.contexts = append(c.contexts, ci)
+	return ci.packages
+}
+
+// Hits returns the number of imports that were resolved from the cache.
+func (c *ImportCache) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
+
+// Misses returns the number of imports that were resolved using the build context.
+func (c *ImportCache) Misses() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.misses
+}
+
+// Reset removes every cached package e.x after downloading new modules, the counters are kept.
+func (c *ImportCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contexts = nil
+}
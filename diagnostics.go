@@ -0,0 +1,72 @@
+package source
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// Diagnostic describes a construct that was skipped while parsing the source.
+type Diagnostic struct {
+	Position token.Position
+
+	// the kind of the skipped construct e.x `field tag`, `method`, `function` or `declaration`
+	Kind string
+
+	// the name of the skipped construct, empty if it has no name
+	Name   string
+	Reason string
+}
+
+func (d Diagnostic) String() string {
+	name := d.Kind
+	if d.Name != "" {
+		name = fmt.Sprintf("%s `%s`", d.Kind, d.Name)
+	}
+	return fmt.Sprintf("%s: %s skipped: %s", d.Position, name, d.Reason)
+}
+
+// diagnostics collects the diagnostics of a parse, a nil collector ignores every report
+// e.x when parsing function types inside other types.
+type diagnostics struct {
+	tokenFile *token.File
+	list      []Diagnostic
+}
+
+func (d *diagnostics) report(pos token.Pos, kind, name, reason string) {
+	if d == nil {
+		return
+	}
+	position := token.Position{}
+	if d.tokenFile != nil && pos.IsValid() {
+		position = d.tokenFile.Position(pos)
+	}
+	d.list = append(d.list, Diagnostic{
+		Position: position,
+		Kind:     kind,
+		Name:     name,
+		Reason:   reason,
+	})
+}
+
+// strictError converts the first diagnostic to a parse error, used with WithStrict.
+func strictError(src string, list []Diagnostic) *ParseError {
+	d := list[0]
+	msg := fmt.Sprintf("%s skipped: %s", d.Kind, d.Reason)
+	if d.Name != "" {
+		msg = fmt.Sprintf("%s `%s` skipped: %s", d.Kind, d.Name, d.Reason)
+	}
+	if len(list) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(list)-1)
+	}
+	pe := &ParseError{
+		Filename: d.Position.Filename,
+		Line:     d.Position.Line,
+		Column:   d.Position.Column,
+		Msg:      msg,
+	}
+	if lines := strings.Split(src, "\n"); pe.Line > 0 && pe.Line <= len(lines) {
+		pe.Snippet = lines[pe.Line-1]
+	}
+	return pe
+}
@@ -0,0 +1,202 @@
+package source
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the number of unchanged lines around the changes of a diff hunk
+const diffContext = 3
+
+// Diff returns the unified diff between the text the source was parsed from, or last saved,
+// and the current text of the source, the diff is empty if nothing changed.
+// The current text is not formatted, String returns the formatted source that is saved.
+func (s *Source) Diff() (string, error) {
+	name := s.path
+	if name == "" {
+		name = s.parser.filename
+	}
+	return unifiedDiff(name, s.original, s.file.src), nil
+}
+
+// Edits returns the edits that change the text the source was parsed from, or last saved,
+// to the current text of the source.
+// The edits do not overlap and are sorted by offset, the offsets are in the original text.
+func (s *Source) Edits() ([]TextEdit, error) {
+	a, b := splitLines(s.original), splitLines(s.file.src)
+	offsets := make([]int, len(a)+1)
+	for i, l := range a {
+		offsets[i+1] = offsets[i] + len(l)
+	}
+	var edits []TextEdit
+	for _, c := range diffLines(a, b) {
+		edits = append(edits, TextEdit{
+			Offset: offsets[c.a0],
+			Length: offsets[c.a1] - offsets[c.a0],
+			Text:   strings.Join(b[c.b0:c.b1], ""),
+		})
+	}
+	return edits, nil
+}
+
+// lineChunk replaces the lines a[a0:a1] with b[b0:b1].
+type lineChunk struct {
+	a0, a1 int
+	b0, b1 int
+}
+
+// splitLines splits the text after every new line, the last line does not end with a new line
+// if the text does not.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the changed chunks of the shortest edit script from a to b using the Myers algorithm.
+func diffLines(a, b []string) []lineChunk {
+	n, m := len(a), len(b)
+	// trace[d] holds the furthest x of every diagonal k in [-d, d] after d edits at index k+d
+	var trace [][]int
+	for d := 0; ; d++ {
+		v := make([]int, 2*d+1)
+		done := false
+		for k := -d; k <= d && !done; k += 2 {
+			x := 0
+			if d > 0 {
+				prev := trace[d-1]
+				if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+					x = prev[k+1+d-1]
+				} else {
+					x = prev[k-1+d-1] + 1
+				}
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+			done = x >= n && y >= m
+		}
+		trace = append(trace, v)
+		if done {
+			break
+		}
+	}
+
+	// walk the trace back from the end and collect the changed chunks
+	var chunks []lineChunk
+	add := func(x, y int, insert bool) {
+		c := lineChunk{a0: x, a1: x, b0: y, b1: y}
+		if insert {
+			c.b1++
+		} else {
+			c.a1++
+		}
+		if len(chunks) > 0 {
+			last := &chunks[len(chunks)-1]
+			if last.a0 == c.a1 && last.b0 == c.b1 {
+				last.a0, last.b0 = c.a0, c.b0
+				return
+			}
+		}
+		chunks = append(chunks, c)
+	}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		insert := k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1])
+		prevK := k - 1
+		if insert {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		// the lines after the edit are unchanged
+		begin := prevX
+		if !insert {
+			begin++
+		}
+		for x > begin {
+			x--
+			y--
+		}
+		add(prevX, prevY, insert)
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(chunks)-1; i < j; i, j = i+1, j-1 {
+		chunks[i], chunks[j] = chunks[j], chunks[i]
+	}
+	return chunks
+}
+
+// unifiedDiff returns the unified diff of the two texts, name is used in both file headers.
+func unifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	al, bl := splitLines(a), splitLines(b)
+	chunks := diffLines(al, bl)
+	if len(chunks) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	writeLine := func(prefix, line string) {
+		out.WriteString(prefix + line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	for i := 0; i < len(chunks); {
+		// a hunk contains the chunks that are separated by at most twice the context
+		j := i + 1
+		for j < len(chunks) && chunks[j].a0-chunks[j-1].a1 <= 2*diffContext {
+			j++
+		}
+		a0 := chunks[i].a0 - diffContext
+		if a0 < 0 {
+			a0 = 0
+		}
+		b0 := chunks[i].b0 - (chunks[i].a0 - a0)
+		a1 := chunks[j-1].a1 + diffContext
+		if a1 > len(al) {
+			a1 = len(al)
+		}
+		b1 := chunks[j-1].b1 + (a1 - chunks[j-1].a1)
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(a0, a1), hunkRange(b0, b1))
+		line := a0
+		for _, c := range chunks[i:j] {
+			for ; line < c.a0; line++ {
+				writeLine(" ", al[line])
+			}
+			for _, l := range al[c.a0:c.a1] {
+				writeLine("-", l)
+			}
+			for _, l := range bl[c.b0:c.b1] {
+				writeLine("+", l)
+			}
+			line = c.a1
+		}
+		for ; line < a1; line++ {
+			writeLine(" ", al[line])
+		}
+		i = j
+	}
+	return out.String()
+}
+
+// hunkRange returns the line range of a hunk e.x `3,4`, an empty range starts at the line before it.
+func hunkRange(begin, end int) string {
+	if begin == end {
+		return fmt.Sprintf("%d,0", begin)
+	}
+	return fmt.Sprintf("%d,%d", begin+1, end-begin)
+}
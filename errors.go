@@ -0,0 +1,207 @@
+package source
+
+import (
+	"fmt"
+	"go/scanner"
+	"strings"
+
+	"github.com/go-errors/errors"
+)
+
+// Sentinel errors that match every error of their type with errors.Is
+// e.x errors.Is(err, ErrNotFound) is the same as errors.Is(err, &NotFoundError{}).
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrAmbiguous   = errors.New("ambiguous name")
+	ErrUnsupported = errors.New("unsupported edit")
+)
+
+// Errors returned by Tx.Commit.
+var (
+	// ErrTxDone is returned when the transaction was already committed or rolled back.
+	ErrTxDone = errors.New("transaction already finished")
+
+	// ErrTxStale is returned when the source was changed outside of the transaction since it began.
+	ErrTxStale = errors.New("source was changed since the transaction began")
+)
+
+// NotFoundError is returned when a node can not be found.
+// It can be matched with errors.Is, empty fields of the target match any value
+// e.x errors.Is(err, &NotFoundError{}) matches every not found error and
+// errors.Is(err, &NotFoundError{Kind: "structure"}) only missing structures.
+type NotFoundError struct {
+	// the kind of the node e.x `structure`, `field` or `method`
+	Kind string
+	Name string
+
+	// the kind and name of the node that was searched e.x the interface of a method,
+	// empty for top level nodes
+	ParentKind string
+	Parent     string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Parent == "" {
+		return fmt.Sprintf("no %s with name `%s` found", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("%s with name `%s` not found in %s `%s`", e.Kind, e.Name, e.ParentKind, e.Parent)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	if target == ErrNotFound {
+		return true
+	}
+	t, ok := target.(*NotFoundError)
+	if !ok {
+		return false
+	}
+	return (t.Kind == "" || t.Kind == e.Kind) &&
+		(t.Name == "" || t.Name == e.Name) &&
+		(t.ParentKind == "" || t.ParentKind == e.ParentKind) &&
+		(t.Parent == "" || t.Parent == e.Parent)
+}
+
+// AmbiguousError is returned when a name matches more than one node e.x a method name
+// that is declared on more than one type.
+// Like NotFoundError it can be matched with errors.Is, empty fields of the target match any value.
+type AmbiguousError struct {
+	// the kind of the node e.x `function`
+	Kind string
+	Name string
+
+	// the keys of the matching nodes e.x `User.Get` and `Order.Get`
+	Matches []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("%s name `%s` is ambiguous, it matches `%s`", e.Kind, e.Name, strings.Join(e.Matches, "`, `"))
+}
+
+func (e *AmbiguousError) Is(target error) bool {
+	if target == ErrAmbiguous {
+		return true
+	}
+	t, ok := target.(*AmbiguousError)
+	if !ok {
+		return false
+	}
+	return (t.Kind == "" || t.Kind == e.Kind) && (t.Name == "" || t.Name == e.Name)
+}
+
+// UnsupportedError is returned when an edit operation can not be applied to a node
+// e.x removing one of the constants declared together in `const a, b = 1, 2`.
+// Like NotFoundError it can be matched with errors.Is, empty fields of the target match any value.
+type UnsupportedError struct {
+	// the name of the operation e.x `RemoveConstant`
+	Op   string
+	Name string
+
+	// why the operation can not be applied
+	Reason string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s `%s` is not supported, %s", e.Op, e.Name, e.Reason)
+}
+
+func (e *UnsupportedError) Is(target error) bool {
+	if target == ErrUnsupported {
+		return true
+	}
+	t, ok := target.(*UnsupportedError)
+	if !ok {
+		return false
+	}
+	return (t.Op == "" || t.Op == e.Op) && (t.Name == "" || t.Name == e.Name)
+}
+
+// UnresolvedEmbedsError is returned by MethodSet together with the resolved methods when embedded
+// interfaces can not be resolved e.x `io.Closer` or an interface that is not declared in the file.
+type UnresolvedEmbedsError struct {
+	Interface string
+
+	// the names of the embeds as they are written e.x `io.Closer`
+	Embeds []string
+}
+
+func (e *UnresolvedEmbedsError) Error() string {
+	return fmt.Sprintf("embeds `%s` of interface `%s` can not be resolved", strings.Join(e.Embeds, "`, `"), e.Interface)
+}
+
+// ParseError is returned when the source is not valid go code.
+type ParseError struct {
+	// the position of the first syntax error
+	Filename     string
+	Line, Column int
+	Msg          string
+
+	// the source line that contains the syntax error
+	Snippet string
+
+	// the error returned by the go parser
+	Err error
+}
+
+func newParseError(src string, err error) *ParseError {
+	pe := &ParseError{
+		Msg: err.Error(),
+		Err: err,
+	}
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return pe
+	}
+	pe.Filename = list[0].Pos.Filename
+	pe.Line = list[0].Pos.Line
+	pe.Column = list[0].Pos.Column
+	pe.Msg = list[0].Msg
+	if lines := strings.Split(src, "\n"); pe.Line > 0 && pe.Line <= len(lines) {
+		pe.Snippet = lines[pe.Line-1]
+	}
+	return pe
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%d:%d: %s\n\t%s", e.Line, e.Column, e.Msg, strings.TrimSpace(e.Snippet))
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// EditError is returned when an edit operation produces code that can not be parsed.
+type EditError struct {
+	// the name of the operation e.x `AppendFieldToStruct`
+	Op  string
+	Err error
+}
+
+func (e *EditError) Error() string {
+	return fmt.Sprintf("%s produced invalid code: %s", e.Op, e.Err)
+}
+
+func (e *EditError) Unwrap() error {
+	return e.Err
+}
+
+// ReadOnlyError is returned when saving a source that was loaded from the fs.FS of a build context
+// e.x MapBuildContext, the source can only be written to disk using SaveAs.
+type ReadOnlyError struct {
+	Path string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("source `%s` was loaded from a read-only fs, use SaveAs to write it to disk", e.Path)
+}
+
+// ConflictError is returned when saving a source whose file was changed on disk since it was opened.
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("file `%s` was changed on disk since it was opened", e.Path)
+}
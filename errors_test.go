@@ -0,0 +1,85 @@
+package source
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-services/code"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	_, err := New(`package source
+
+type User struct {
+	ID string
+`)
+	var parseErr *ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, 4, parseErr.Line)
+
+	src, err := New(`package source
+
+type Service interface {
+	Get() error
+}
+`)
+	assert.NoError(t, err)
+
+	_, err = src.GetStructure("User")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, &NotFoundError{}))
+	assert.True(t, errors.Is(err, &NotFoundError{Kind: "structure", Name: "User"}))
+	assert.False(t, errors.Is(err, &NotFoundError{Kind: "interface"}))
+
+	err = src.CommentInterfaceMethod("Service", "Delete", "deletes")
+	var notFound *NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "method", notFound.Kind)
+	assert.Equal(t, "Service", notFound.Parent)
+
+	err = src.AppendMethodToInterface("Service", code.NewInterfaceMethod("List("))
+	var editErr *EditError
+	assert.True(t, errors.As(err, &editErr))
+	assert.Equal(t, "AppendMethodToInterface", editErr.Op)
+	assert.True(t, errors.As(err, &parseErr))
+
+	// the source is restored after an invalid edit
+	_, err = src.String()
+	assert.NoError(t, err)
+
+	src, err = New(`package source
+
+const a, b = 1, 2
+
+type User struct {
+	Service
+}
+
+func (u User) Get() {}
+
+func (s Service) Get() {}
+
+type Service struct{}
+`)
+	assert.NoError(t, err)
+
+	err = src.RemoveConstant("a")
+	var unsupported *UnsupportedError
+	assert.True(t, errors.As(err, &unsupported))
+	assert.Equal(t, "RemoveConstant", unsupported.Op)
+	assert.Equal(t, "a", unsupported.Name)
+
+	err = src.RenameField("User", "Service", "Svc")
+	assert.True(t, errors.Is(err, &UnsupportedError{Op: "RenameField"}))
+	assert.False(t, errors.Is(err, &UnsupportedError{Op: "RemoveConstant"}))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	assert.False(t, errors.Is(err, ErrNotFound))
+
+	_, err = src.GetFunction("Get")
+	var ambiguous *AmbiguousError
+	assert.True(t, errors.As(err, &ambiguous))
+	assert.Equal(t, []string{"Service.Get", "User.Get"}, ambiguous.Matches)
+	assert.True(t, errors.Is(err, &AmbiguousError{Kind: "function"}))
+	assert.True(t, errors.Is(err, ErrAmbiguous))
+}
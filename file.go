@@ -2,7 +2,9 @@ package source
 
 import (
 	"go/ast"
+	"go/token"
 
+	"github.com/dave/jennifer/jen"
 	"github.com/go-services/code"
 )
 
@@ -13,6 +15,11 @@ type Node interface {
 	Name() string
 	Begin() int
 	End() int
+	Position() token.Position
+	EndPosition() token.Position
+
+	// the annotations and directives in the doc comment of the node
+	Annotations() []Annotation
 }
 
 type NodeWithInner interface {
@@ -24,20 +31,54 @@ type NodeWithInner interface {
 
 // Import represents an import
 type Import struct {
-	ast ast.Decl
+	ast *ast.ImportSpec
 	// code representation of import
 	code code.Import
 	// the package name of the import
 	// e.x some/import/path does not guaranty the package name to be `path` we need
 	// a way to get that package name when using import in types
 	pkg string
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
+	// the beginning and end positions of the import specification
+	begin, end int
+}
+
+// TypeParam represents a generic type parameter
+// e.x `T any` in `type Repo[T any] struct{}`
+type TypeParam struct {
+	// the name of the type parameter
+	Name string
+
+	// the constraint of the type parameter, union constraints are represented using RawType
+	Constraint code.Type
+
+	// the terms of the constraint, a constraint that is not a union has a single term
+	// e.x `~int | ~string` has the terms `~int` and `~string`
+	Terms []TypeTerm
+}
+
+// TypeTerm represents a single term of a type constraint
+type TypeTerm struct {
+	// true if the term is prefixed with `~`
+	Tilde bool
+	Type  code.Type
 }
 
 type StructureField struct {
 	exported bool
+	ast      *ast.Field
+
+	// true if the field is an embedded field e.x `io.Reader`
+	embedded bool
 	// code representation of the struct field
 	code code.StructField
 
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
 	// the beginning and end positions of the struct field definition
 	// corresponds to the Pos() and End() of the ast declaration
 	begin, end int
@@ -50,9 +91,18 @@ type Structure struct {
 	// code representation of the struct
 	code code.Struct
 
+	// the generic type parameters of the struct
+	typeParams []TypeParam
+
 	// the structure fields
 	fields []StructureField
 
+	// the methods declared in the file with the structure as receiver
+	methods []Function
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
 	// the beginning and end positions of the struct definition
 	// corresponds to the Pos() and End() of the ast declaration
 	begin, end int
@@ -64,9 +114,13 @@ type Structure struct {
 
 type InterfaceMethod struct {
 	exported bool
+	ast      *ast.Field
 	// code representation of the interface method
 	code code.InterfaceMethod
 
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
 	// the beginning and end positions of the interface method definition
 	// corresponds to the Pos() and End() of the ast declaration
 	begin, end int
@@ -80,9 +134,18 @@ type Interface struct {
 	// code representation of the interface
 	code code.Interface
 
+	// the generic type parameters of the interface
+	typeParams []TypeParam
+
 	// the interface methods
 	methods []InterfaceMethod
 
+	// the embedded interfaces and type elements e.x `io.Reader` or `~int | ~string`
+	embeds []code.Type
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
 	// the beginning and end positions of the interface definition
 	// corresponds to the Pos() and End() of the ast declaration
 	begin, end int
@@ -99,6 +162,16 @@ type Function struct {
 	// code representation of the function
 	code code.Function
 
+	// the generic type parameters of the function
+	typeParams []TypeParam
+
+	// the name of the receiver type without pointer and type parameters
+	// e.x `Repo` for `func (r *Repo[T]) Get()`, empty if the function is not a method
+	receiverType string
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
 	// the beginning and end positions of the function definition
 	// corresponds to the Pos() and End() of the ast declaration
 	begin, end int
@@ -114,32 +187,222 @@ type Function struct {
 	resultBegin, resultEnd int
 }
 
+// NamedType represents a parsed type declaration that is neither a structure nor an interface
+// e.x `type Status int` or the alias `type ID = string`
+type NamedType struct {
+	exported bool
+	ast      *ast.TypeSpec
+	name     string
+
+	// true if the declaration is an alias e.x `type ID = string`
+	alias bool
+
+	// the underlying type of the declaration
+	tp code.Type
+
+	// the generic type parameters of the type
+	typeParams []TypeParam
+
+	// the methods declared in the file with the type as receiver
+	methods []Function
+
+	docs []code.Comment
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
+	// the beginning and end positions of the type definition
+	// corresponds to the Pos() and End() of the ast declaration
+	begin, end int
+}
+
+// Constant represents a parsed top-level constant
+type Constant struct {
+	exported bool
+	name     string
+	decl     *ast.GenDecl
+	spec     *ast.ValueSpec
+
+	// the type of the constant, nil if the constant is untyped or the type is not supported
+	tp *code.Type
+
+	// the source of the value expression, constants in a group that omit the value
+	// repeat the expression of the previous constant e.x in `iota` enums
+	value string
+
+	// the value of `iota` for the constant, that is the index of the constant in its group
+	iota int
+
+	// true if the constant belongs to a group that uses `iota`
+	enum bool
+
+	docs []code.Comment
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
+	// the beginning and end positions of the constant definition
+	// corresponds to the Pos() and End() of the ast specification
+	begin, end int
+}
+
+// Variable represents a parsed top-level variable
+type Variable struct {
+	exported bool
+	name     string
+	decl     *ast.GenDecl
+	spec     *ast.ValueSpec
+
+	// the type of the variable, nil if the type is inferred or not supported
+	tp *code.Type
+
+	// the source of the value expression, empty if the variable is not initialized
+	value string
+
+	docs []code.Comment
+
+	// the token file of the source, used to resolve positions
+	tokenFile *token.File
+
+	// the beginning and end positions of the variable definition
+	// corresponds to the Pos() and End() of the ast specification
+	begin, end int
+}
+
+// DeclKind is the kind of a top level declaration.
+type DeclKind int
+
+const (
+	StructureDecl DeclKind = iota
+	InterfaceDecl
+	FunctionDecl
+	NamedTypeDecl
+	ConstantDecl
+	VariableDecl
+)
+
+func (k DeclKind) String() string {
+	switch k {
+	case StructureDecl:
+		return "structure"
+	case InterfaceDecl:
+		return "interface"
+	case FunctionDecl:
+		return "function"
+	case NamedTypeDecl:
+		return "named type"
+	case ConstantDecl:
+		return "constant"
+	case VariableDecl:
+		return "variable"
+	}
+	return "unknown"
+}
+
+// Decl is a top level declaration together with its kind.
+type Decl struct {
+	Kind DeclKind
+	Node Node
+}
+
+// declRef references a top level declaration by its kind and the key it is stored with in the file.
+type declRef struct {
+	kind DeclKind
+	key  string
+}
+
 // file represents a parsed file.
 type file struct {
-	pkg        string
-	src        string
+	pkg string
+	src string
+	// the source the ast was parsed from, edits change src before the file is parsed again
+	// so this is used to restore the file when an edit produces invalid code
+	parsedSrc  string
 	ast        *ast.File
 	imports    []Import
 	structures map[string]Structure
 	interfaces map[string]Interface
 	functions  map[string]Function
+	namedTypes map[string]NamedType
+	constants  map[string]Constant
+	variables  map[string]Variable
+
+	// the top level declarations in the order they are declared in the source
+	order []declRef
+
+	// the constructs that were skipped while parsing
+	diagnostics []Diagnostic
+
+	// true if a declaration was parsed incrementally, the identifiers that reference
+	// declarations in other declarations are not resolved
+	incremental bool
 }
 
 func newFile(pkg, src string, ast *ast.File) *file {
 	return &file{
 		pkg:        pkg,
 		src:        src,
+		parsedSrc:  src,
 		ast:        ast,
 		structures: map[string]Structure{},
 		interfaces: map[string]Interface{},
 		functions:  map[string]Function{},
+		namedTypes: map[string]NamedType{},
+		constants:  map[string]Constant{},
+		variables:  map[string]Variable{},
+	}
+}
+
+// record adds the declaration to the declaration order, declarations that are
+// already recorded e.x multiple `init` functions keep their first position.
+func (f *file) record(kind DeclKind, key string) {
+	if f.node(declRef{kind: kind, key: key}) == nil {
+		f.order = append(f.order, declRef{kind: kind, key: key})
+	}
+}
+
+// node returns the declaration the reference points to, nil if there is none.
+func (f *file) node(ref declRef) Node {
+	var node Node
+	var ok bool
+	switch ref.kind {
+	case StructureDecl:
+		node, ok = f.structures[ref.key]
+	case InterfaceDecl:
+		node, ok = f.interfaces[ref.key]
+	case FunctionDecl:
+		node, ok = f.functions[ref.key]
+	case NamedTypeDecl:
+		node, ok = f.namedTypes[ref.key]
+	case ConstantDecl:
+		node, ok = f.constants[ref.key]
+	case VariableDecl:
+		node, ok = f.variables[ref.key]
 	}
+	if !ok {
+		return nil
+	}
+	return node
+}
+
+// declOf returns the declaration that contains the specification.
+func (f *file) declOf(spec ast.Spec) *ast.GenDecl {
+	for _, d := range f.ast.Decls {
+		if gd, ok := d.(*ast.GenDecl); ok && specIndex(gd, spec) >= 0 {
+			return gd
+		}
+	}
+	return nil
 }
 
 func (s Structure) Name() string {
 	return s.code.Name
 }
 
+func (s Structure) Annotations() []Annotation {
+	return parseAnnotations(s.ast.Doc, s.tokenFile)
+}
+
 func (s Structure) Begin() int {
 	return s.begin
 }
@@ -176,10 +439,22 @@ func (s Structure) Exported() bool {
 	return s.exported
 }
 
+func (s Structure) TypeParams() []TypeParam {
+	return s.typeParams
+}
+
+func (s Structure) Methods() []Function {
+	return s.methods
+}
+
 func (i Interface) Name() string {
 	return i.code.Name
 }
 
+func (i Interface) Annotations() []Annotation {
+	return parseAnnotations(i.ast.Doc, i.tokenFile)
+}
+
 func (i Interface) Begin() int {
 	return i.begin
 }
@@ -208,18 +483,33 @@ func (i Interface) String() string {
 	return i.code.String()
 }
 
+// Methods returns the methods declared in the interface, methods of embedded interfaces are not included
+// use Source.MethodSet to get every method of the interface.
 func (i Interface) Methods() []InterfaceMethod {
 	return i.methods
 }
 
+// Embeds returns the embedded interfaces and type elements of the interface.
+func (i Interface) Embeds() []code.Type {
+	return i.embeds
+}
+
 func (i Interface) Exported() bool {
 	return i.exported
 }
 
+func (i Interface) TypeParams() []TypeParam {
+	return i.typeParams
+}
+
 func (f Function) Name() string {
 	return f.code.Name
 }
 
+func (f Function) Annotations() []Annotation {
+	return parseAnnotations(f.ast.(*ast.FuncDecl).Doc, f.tokenFile)
+}
+
 func (f Function) Begin() int {
 	return f.begin
 }
@@ -272,10 +562,45 @@ func (f Function) Exported() bool {
 	return f.exported
 }
 
+func (f Function) TypeParams() []TypeParam {
+	return f.typeParams
+}
+
+func (f Function) IsMethod() bool {
+	return f.receiverType != ""
+}
+
+// ReceiverType returns the name of the receiver type, empty if the function is not a method.
+func (f Function) ReceiverType() string {
+	return f.receiverType
+}
+
+// Key returns the name used to look up the function, methods are prefixed with their receiver type e.x `Repo.Get`.
+func (f Function) Key() string {
+	return functionKey(f.receiverType, f.Name())
+}
+
+// Name returns the name of the field, for embedded fields this is the
+// name of the type without pointer and package e.x `Reader` for `*io.Reader`.
 func (f StructureField) Name() string {
+	if f.embedded {
+		return embeddedFieldName(f.ast.Type)
+	}
 	return f.code.Name
 }
 
+func (f StructureField) Annotations() []Annotation {
+	return parseAnnotations(f.ast.Doc, f.tokenFile)
+}
+
+func (f StructureField) Embedded() bool {
+	return f.embedded
+}
+
+func (f StructureField) Type() code.Type {
+	return f.code.Type
+}
+
 func (f StructureField) String() string {
 	return f.code.String()
 }
@@ -289,6 +614,9 @@ func (f StructureField) Field() code.StructField {
 }
 
 func (f StructureField) Tags() map[string]string {
+	if f.code.Tags == nil {
+		return map[string]string{}
+	}
 	return *f.code.Tags
 }
 
@@ -308,6 +636,14 @@ func (f InterfaceMethod) Name() string {
 	return f.code.Name
 }
 
+func (f InterfaceMethod) Annotations() []Annotation {
+	// methods added from embedded types e.x `error` have no ast
+	if f.ast == nil {
+		return nil
+	}
+	return parseAnnotations(f.ast.Doc, f.tokenFile)
+}
+
 func (f InterfaceMethod) String() string {
 	return f.code.String()
 }
@@ -339,3 +675,264 @@ func (f InterfaceMethod) End() int {
 func (f InterfaceMethod) Exported() bool {
 	return f.exported
 }
+
+func (t NamedType) Name() string {
+	return t.name
+}
+
+func (t NamedType) Annotations() []Annotation {
+	return parseAnnotations(t.ast.Doc, t.tokenFile)
+}
+
+func (t NamedType) Begin() int {
+	return t.begin
+}
+
+func (t NamedType) End() int {
+	return t.end
+}
+
+func (t NamedType) Exported() bool {
+	return t.exported
+}
+
+func (t NamedType) IsAlias() bool {
+	return t.alias
+}
+
+// Type returns the underlying type e.x `int` for `type Status int`.
+func (t NamedType) Type() code.Type {
+	return t.tp
+}
+
+func (t NamedType) TypeParams() []TypeParam {
+	return t.typeParams
+}
+
+func (t NamedType) Methods() []Function {
+	return t.methods
+}
+
+func (t NamedType) Docs() []code.Comment {
+	return t.docs
+}
+
+func (t NamedType) Code() code.Code {
+	statement := jen.Type().Id(t.name)
+	if t.alias {
+		statement.Op("=")
+	}
+	return code.NewRawCode(statement.Add(t.tp.Code()))
+}
+
+func (t NamedType) String() string {
+	return t.Code().String()
+}
+
+func (c Constant) Name() string {
+	return c.name
+}
+
+func (c Constant) Annotations() []Annotation {
+	return parseAnnotations(c.spec.Doc, c.tokenFile)
+}
+
+func (c Constant) Begin() int {
+	return c.begin
+}
+
+func (c Constant) End() int {
+	return c.end
+}
+
+func (c Constant) Exported() bool {
+	return c.exported
+}
+
+func (c Constant) Type() *code.Type {
+	return c.tp
+}
+
+func (c Constant) Value() string {
+	return c.value
+}
+
+func (c Constant) Iota() int {
+	return c.iota
+}
+
+func (c Constant) Enum() bool {
+	return c.enum
+}
+
+func (c Constant) Docs() []code.Comment {
+	return c.docs
+}
+
+// Grouped returns true if the constant is declared inside a `const (...)` block.
+func (c Constant) Grouped() bool {
+	return c.decl.Lparen != token.NoPos
+}
+
+func (c Constant) Code() code.Code {
+	return code.NewRawCode(valueCode(jen.Const(), c.name, c.tp, c.value))
+}
+
+func (c Constant) String() string {
+	return c.Code().String()
+}
+
+func (v Variable) Name() string {
+	return v.name
+}
+
+func (v Variable) Annotations() []Annotation {
+	return parseAnnotations(v.spec.Doc, v.tokenFile)
+}
+
+func (v Variable) Begin() int {
+	return v.begin
+}
+
+func (v Variable) End() int {
+	return v.end
+}
+
+func (v Variable) Exported() bool {
+	return v.exported
+}
+
+func (v Variable) Type() *code.Type {
+	return v.tp
+}
+
+func (v Variable) Value() string {
+	return v.value
+}
+
+func (v Variable) Docs() []code.Comment {
+	return v.docs
+}
+
+// Grouped returns true if the variable is declared inside a `var (...)` block.
+func (v Variable) Grouped() bool {
+	return v.decl.Lparen != token.NoPos
+}
+
+func (v Variable) Code() code.Code {
+	return code.NewRawCode(valueCode(jen.Var(), v.name, v.tp, v.value))
+}
+
+func (v Variable) String() string {
+	return v.Code().String()
+}
+
+// offsetPosition returns the position of the offset in the token file,
+// the zero position is returned for nodes that were not parsed from a file.
+func offsetPosition(tokenFile *token.File, offset int) token.Position {
+	if tokenFile == nil || offset < 0 || offset > tokenFile.Size() {
+		return token.Position{}
+	}
+	return tokenFile.Position(tokenFile.Pos(offset))
+}
+
+func (i Import) Import() code.Import {
+	return i.code
+}
+
+// Package returns the package name of the import, empty if it could not be resolved.
+func (i Import) Package() string {
+	return i.pkg
+}
+
+// Name returns the name the package is referenced with in the file, that is the alias
+// or the package name e.x `_`, `errs` or `errors`.
+func (i Import) Name() string {
+	if i.code.Alias != "" {
+		return i.code.Alias
+	}
+	if i.pkg != "" {
+		return i.pkg
+	}
+	return defaultImportName(i.code.Path)
+}
+
+func (i Import) Begin() int {
+	return i.begin
+}
+
+func (i Import) End() int {
+	return i.end
+}
+
+func (i Import) Position() token.Position {
+	return offsetPosition(i.tokenFile, i.begin)
+}
+
+func (i Import) EndPosition() token.Position {
+	return offsetPosition(i.tokenFile, i.end)
+}
+
+func (s Structure) Position() token.Position {
+	return offsetPosition(s.tokenFile, s.begin)
+}
+
+func (s Structure) EndPosition() token.Position {
+	return offsetPosition(s.tokenFile, s.end)
+}
+
+func (f StructureField) Position() token.Position {
+	return offsetPosition(f.tokenFile, f.begin)
+}
+
+func (f StructureField) EndPosition() token.Position {
+	return offsetPosition(f.tokenFile, f.end)
+}
+
+func (i Interface) Position() token.Position {
+	return offsetPosition(i.tokenFile, i.begin)
+}
+
+func (i Interface) EndPosition() token.Position {
+	return offsetPosition(i.tokenFile, i.end)
+}
+
+func (f InterfaceMethod) Position() token.Position {
+	return offsetPosition(f.tokenFile, f.begin)
+}
+
+func (f InterfaceMethod) EndPosition() token.Position {
+	return offsetPosition(f.tokenFile, f.end)
+}
+
+func (f Function) Position() token.Position {
+	return offsetPosition(f.tokenFile, f.begin)
+}
+
+func (f Function) EndPosition() token.Position {
+	return offsetPosition(f.tokenFile, f.end)
+}
+
+func (t NamedType) Position() token.Position {
+	return offsetPosition(t.tokenFile, t.begin)
+}
+
+func (t NamedType) EndPosition() token.Position {
+	return offsetPosition(t.tokenFile, t.end)
+}
+
+func (c Constant) Position() token.Position {
+	return offsetPosition(c.tokenFile, c.begin)
+}
+
+func (c Constant) EndPosition() token.Position {
+	return offsetPosition(c.tokenFile, c.end)
+}
+
+func (v Variable) Position() token.Position {
+	return offsetPosition(v.tokenFile, v.begin)
+}
+
+func (v Variable) EndPosition() token.Position {
+	return offsetPosition(v.tokenFile, v.end)
+}
@@ -0,0 +1,92 @@
+package source
+
+import (
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// formatChanges formats the lines of src that were changed from original, changed top level
+// declarations are formatted as a whole so their alignment stays consistent.
+// The rest of the source is kept as it is written, if the result is not valid the whole source is formatted.
+func formatChanges(original, src string) (string, error) {
+	if src == original {
+		return src, nil
+	}
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return "", err
+	}
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return string(formatted), nil
+	}
+	lines := splitLines(src)
+	touched := make([]bool, len(lines))
+	mark := func(from, to int) {
+		for i := from; i < to; i++ {
+			touched[i] = true
+		}
+	}
+
+	// removed lines only touch the declaration they were removed from and the blank lines around them
+	changes := diffLines(splitLines(original), lines)
+	for _, c := range changes {
+		mark(c.b0, c.b1)
+		if c.b0 == c.b1 {
+			for _, i := range []int{c.b0 - 1, c.b0} {
+				if i >= 0 && i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+					touched[i] = true
+				}
+			}
+		}
+	}
+	tokenFile := fset.File(astFile.Pos())
+	for _, d := range astFile.Decls {
+		begin := d.Pos()
+		if doc := declDoc(d); doc != nil {
+			begin = doc.Pos()
+		}
+		first, last := tokenFile.Line(begin)-1, tokenFile.Line(d.End())-1
+		for _, c := range changes {
+			if (c.b0 < c.b1 && c.b0 <= last && c.b1 > first) || (c.b0 == c.b1 && c.b0 > first && c.b0 <= last) {
+				mark(first, last+1)
+				break
+			}
+		}
+	}
+
+	// apply the formatting of the touched lines
+	var out strings.Builder
+	formattedLines := splitLines(string(formatted))
+	line := 0
+	for _, c := range diffLines(lines, formattedLines) {
+		for ; line < c.a0; line++ {
+			out.WriteString(lines[line])
+		}
+		from, to := c.a0, c.a1
+		if from == to {
+			// lines added by the formatter are applied if a line next to them is touched
+			from, to = from-1, to+1
+		}
+		apply := false
+		for i := from; i < to; i++ {
+			apply = apply || (i >= 0 && i < len(lines) && touched[i])
+		}
+		if apply {
+			out.WriteString(strings.Join(formattedLines[c.b0:c.b1], ""))
+		} else {
+			out.WriteString(strings.Join(lines[c.a0:c.a1], ""))
+		}
+		line = c.a1
+	}
+	for ; line < len(lines); line++ {
+		out.WriteString(lines[line])
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", out.String(), parser.ParseComments); err != nil {
+		return string(formatted), nil
+	}
+	return out.String(), nil
+}
@@ -1,11 +1,17 @@
 module github.com/go-services/source
 
+go 1.18
+
 require (
 	github.com/dave/jennifer v1.7.0
-	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-errors/errors v1.5.1
 	github.com/go-services/code v0.1.11
 	github.com/stretchr/testify v1.4.0
 )
 
-go 1.13
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
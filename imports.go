@@ -0,0 +1,179 @@
+package source
+
+import (
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportOptions configures how imports are organized.
+type ImportOptions struct {
+	// the import path prefixes of the local module separated by commas e.x `github.com/go-services`,
+	// if empty the module path of the nearest go.mod is used
+	LocalPrefix string
+}
+
+// import groups in the order they are written
+const (
+	stdImports = iota
+	thirdPartyImports
+	localImports
+)
+
+// OrganizeImports merges the import declarations into a single sorted block grouped into
+// standard library, third party and local module imports.
+// Comments attached to import specifications are kept.
+func (s *Source) OrganizeImports(opts ImportOptions) error {
+	s.file.src = organizeImports(s.file.src, s.file.ast, s.localPrefixes(opts))
+	return s.parseAgain("OrganizeImports")
+}
+
+// localPrefixes returns the local import path prefixes from the options or go.mod.
+func (s *Source) localPrefixes(opts ImportOptions) (prefixes []string) {
+	if opts.LocalPrefix != "" {
+		for _, p := range strings.Split(opts.LocalPrefix, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				prefixes = append(prefixes, p)
+			}
+		}
+		return prefixes
+	}
+	dir := filepath.Dir(s.path)
+	if s.path == "" {
+		cwd, err := s.parser.buildContext.Cwd()
+		if err != nil {
+			return nil
+		}
+		dir = cwd
+	}
+	if module, _, err := findModule(dir); err == nil {
+		prefixes = append(prefixes, module)
+	}
+	return prefixes
+}
+
+// importGroup returns the group of the import path, standard library paths
+// do not have a dot in their first element.
+func importGroup(path string, localPrefixes []string) int {
+	for _, p := range localPrefixes {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return localImports
+		}
+	}
+	if strings.Contains(strings.Split(path, "/")[0], ".") {
+		return thirdPartyImports
+	}
+	return stdImports
+}
+
+// organizeImports returns the source with the imports of the file sorted and grouped.
+func organizeImports(src string, file *ast.File, localPrefixes []string) string {
+	var decls []*ast.GenDecl
+	for _, d := range file.Decls {
+		// `import "C"` must stay right after the cgo preamble in its docs
+		if dec, ok := d.(*ast.GenDecl); ok && dec.Tok == token.IMPORT && !importsC(dec) {
+			decls = append(decls, dec)
+		}
+	}
+	if len(decls) == 0 || (len(decls) == 1 && len(decls[0].Specs) == 1) {
+		return src
+	}
+	type importLine struct {
+		path, name, text string
+	}
+	var groups [3][]importLine
+	seen := map[string]bool{}
+	for i, dec := range decls {
+		for _, spec := range dec.Specs {
+			is := spec.(*ast.ImportSpec)
+			var lines []string
+			docs := []*ast.CommentGroup{is.Doc}
+			if i > 0 && spec == dec.Specs[0] {
+				// the docs of the first declaration stay on the import block,
+				// the docs of the others are moved to their first specification
+				docs = []*ast.CommentGroup{dec.Doc, is.Doc}
+			}
+			for _, doc := range docs {
+				if doc == nil {
+					continue
+				}
+				for _, c := range doc.List {
+					lines = append(lines, "\t"+c.Text)
+				}
+			}
+			line := "\t" + src[is.Pos()-1:is.End()-1]
+			if is.Comment != nil {
+				line += " " + src[is.Comment.Pos()-1:is.Comment.End()-1]
+			}
+			lines = append(lines, line)
+			path, _ := strconv.Unquote(is.Path.Value)
+			il := importLine{path: path, text: strings.Join(lines, "\n")}
+			if is.Name != nil {
+				il.name = is.Name.Name
+			}
+			if seen[il.name+" "+il.path] {
+				continue
+			}
+			seen[il.name+" "+il.path] = true
+			g := importGroup(path, localPrefixes)
+			groups[g] = append(groups[g], il)
+		}
+	}
+	var sections []string
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		sort.SliceStable(g, func(i, j int) bool {
+			if g[i].path != g[j].path {
+				return g[i].path < g[j].path
+			}
+			return g[i].name < g[j].name
+		})
+		lines := make([]string, len(g))
+		for i, il := range g {
+			lines[i] = il.text
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	block := "import (\n" + strings.Join(sections, "\n\n") + "\n)"
+
+	// remove the other declarations starting from the end so the positions stay valid
+	for i := len(decls) - 1; i > 0; i-- {
+		begin := int(decls[i].Pos()) - 1
+		if decls[i].Doc != nil {
+			begin = int(decls[i].Doc.Pos()) - 1
+		}
+		end := int(decls[i].End()) - 1
+		if c := trailingComment(decls[i]); c != nil {
+			end = int(c.End()) - 1
+		}
+		src = removeCode(src, begin, end)
+	}
+	begin, end := int(decls[0].Pos())-1, int(decls[0].End())-1
+	if c := trailingComment(decls[0]); c != nil {
+		end = int(c.End()) - 1
+	}
+	return src[:begin] + block + src[end:]
+}
+
+// trailingComment returns the comment on the same line after an ungrouped import e.x `import "fmt" // print`,
+// the comment is attached to the specification and is moved with it.
+func trailingComment(dec *ast.GenDecl) *ast.CommentGroup {
+	if dec.Lparen != token.NoPos {
+		return nil
+	}
+	return dec.Specs[0].(*ast.ImportSpec).Comment
+}
+
+func importsC(dec *ast.GenDecl) bool {
+	for _, spec := range dec.Specs {
+		if spec.(*ast.ImportSpec).Path.Value == `"C"` {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,315 @@
+package source
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ModuleBuildContext resolves imports using go modules, that is the main modules from go.work or go.mod,
+// their requirements in the module cache, replace directives and vendor directories.
+// Imports that can not be found are resolved with the last element of the path as package name
+// and an empty directory.
+type ModuleBuildContext struct {
+	dir    string
+	goroot string
+
+	// the module cache e.x `~/go/pkg/mod`
+	modCache string
+
+	// the directories of the main modules by module path
+	mains map[string]string
+
+	// the required version of every module
+	requires map[string]string
+
+	// the replacements by module path, versioned replacements use the `path@version` key
+	replaces map[string]modReplace
+
+	// the vendor directory of the main module, empty if the module is not vendored
+	vendor string
+}
+
+// modReplace is the target of a replace directive, dir is set for replacements with a local directory.
+type modReplace struct {
+	path    string
+	version string
+	dir     string
+}
+
+// NewModuleBuildContext loads the go.work or go.mod file of dir or its parents,
+// if dir is empty the working directory is used.
+func NewModuleBuildContext(dir string) (*ModuleBuildContext, error) {
+	if dir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir = cwd
+	}
+	m := &ModuleBuildContext{
+		dir:      dir,
+		goroot:   build.Default.GOROOT,
+		modCache: os.Getenv("GOMODCACHE"),
+		mains:    map[string]string{},
+		requires: map[string]string{},
+		replaces: map[string]modReplace{},
+	}
+	if m.modCache == "" {
+		if gopath := filepath.SplitList(build.Default.GOPATH); len(gopath) > 0 {
+			m.modCache = filepath.Join(gopath[0], "pkg", "mod")
+		}
+	}
+	if work, ok := findFile(dir, "go.work"); ok && os.Getenv("GOWORK") != "off" {
+		return m, m.loadWork(work)
+	}
+	if gomod, ok := findFile(dir, "go.mod"); ok {
+		if err := m.loadMod(gomod); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(gomod), "vendor", "modules.txt")); err == nil {
+			m.vendor = filepath.Join(filepath.Dir(gomod), "vendor")
+		}
+	}
+	return m, nil
+}
+
+func (m *ModuleBuildContext) loadWork(work string) error {
+	data, err := ioutil.ReadFile(work)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(work)
+	for _, d := range parseModDirectives(string(data)) {
+		switch d.verb {
+		case "use":
+			if err := m.loadMod(filepath.Join(dir, d.args[0], "go.mod")); err != nil {
+				return err
+			}
+		case "replace":
+			m.addReplace(dir, d.args)
+		}
+	}
+	return nil
+}
+
+func (m *ModuleBuildContext) loadMod(gomod string) error {
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(gomod)
+	for _, d := range parseModDirectives(string(data)) {
+		switch d.verb {
+		case "module":
+			m.mains[d.args[0]] = dir
+		case "require":
+			if len(d.args) >= 2 {
+				m.requires[d.args[0]] = d.args[1]
+			}
+		case "replace":
+			// replacements in go.work take precedence over the ones in go.mod
+			if _, ok := m.replaces[d.args[0]]; !ok {
+				m.addReplace(dir, d.args)
+			}
+		}
+	}
+	return nil
+}
+
+// addReplace adds a replace directive e.x `old v1 => new v2` or `old => ../new`.
+func (m *ModuleBuildContext) addReplace(dir string, args []string) {
+	arrow := -1
+	for i, a := range args {
+		if a == "=>" {
+			arrow = i
+		}
+	}
+	if arrow < 1 || arrow == len(args)-1 {
+		return
+	}
+	key := args[0]
+	if arrow == 2 {
+		key += "@" + args[1]
+	}
+	r := modReplace{path: args[arrow+1]}
+	if len(args) > arrow+2 {
+		r.version = args[arrow+2]
+	}
+	if r.version == "" && (filepath.IsAbs(r.path) || strings.HasPrefix(r.path, "./") || strings.HasPrefix(r.path, "../")) {
+		r.dir = r.path
+		if !filepath.IsAbs(r.dir) {
+			r.dir = filepath.Join(dir, r.dir)
+		}
+	}
+	m.replaces[key] = r
+}
+
+// Import returns the directory and package name of the import path, if the package can not be found
+// the package name is guessed from the path and the directory is empty.
+func (m *ModuleBuildContext) Import(path string) (*ImportInfo, error) {
+	for _, dir := range m.packageDirs(path) {
+		if name, ok := dirPackageName(dir); ok {
+			return &ImportInfo{Dir: dir, Name: name}, nil
+		}
+	}
+	return &ImportInfo{Name: defaultImportName(path)}, nil
+}
+
+func (m *ModuleBuildContext) Cwd() (string, error) {
+	return m.dir, nil
+}
+
+// packageDirs returns the directories the package can be in, in the order they are searched.
+func (m *ModuleBuildContext) packageDirs(path string) (dirs []string) {
+	if !strings.Contains(strings.Split(path, "/")[0], ".") {
+		dirs = append(dirs, filepath.Join(m.goroot, "src", filepath.FromSlash(path)))
+	}
+	if mod := longestModule(path, m.mains); mod != "" {
+		return append(dirs, filepath.Join(m.mains[mod], filepath.FromSlash(strings.TrimPrefix(path[len(mod):], "/"))))
+	}
+	if m.vendor != "" {
+		dirs = append(dirs, filepath.Join(m.vendor, filepath.FromSlash(path)))
+	}
+	modules := map[string]string{}
+	for mod := range m.requires {
+		modules[mod] = mod
+	}
+	for key := range m.replaces {
+		mod := strings.Split(key, "@")[0]
+		modules[mod] = mod
+	}
+	mod := longestModule(path, modules)
+	if mod == "" {
+		return dirs
+	}
+	rest := filepath.FromSlash(strings.TrimPrefix(path[len(mod):], "/"))
+	version := m.requires[mod]
+	r, ok := m.replaces[mod+"@"+version]
+	if !ok {
+		r, ok = m.replaces[mod]
+	}
+	switch {
+	case ok && r.dir != "":
+		dirs = append(dirs, filepath.Join(r.dir, rest))
+	case ok:
+		dirs = append(dirs, filepath.Join(m.modCache, escapeModulePath(r.path)+"@"+r.version, rest))
+	case version != "":
+		dirs = append(dirs, filepath.Join(m.modCache, escapeModulePath(mod)+"@"+version, rest))
+	}
+	return dirs
+}
+
+// longestModule returns the longest module path that contains the package path.
+func longestModule(path string, modules map[string]string) (longest string) {
+	for mod := range modules {
+		if (path == mod || strings.HasPrefix(path, mod+"/")) && len(mod) > len(longest) {
+			longest = mod
+		}
+	}
+	return longest
+}
+
+// escapeModulePath escapes the module path the way it is stored in the module cache,
+// upper case letters are replaced with `!` and the lower case letter e.x `github.com/!burnt!sushi`.
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteRune('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dirPackageName returns the package name of the go files in the directory that match the
+// default build context, test files are skipped.
+func dirPackageName(dir string) (string, bool) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	names := map[string]int{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") || strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, e.Name()); err != nil || !match {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, e.Name()), nil, parser.PackageClauseOnly)
+		if err != nil || f.Name.Name == "documentation" {
+			continue
+		}
+		names[f.Name.Name]++
+	}
+	best := ""
+	for name, n := range names {
+		if best == "" || n > names[best] || (n == names[best] && name < best) {
+			best = name
+		}
+	}
+	return best, best != ""
+}
+
+// findFile returns the path of the file in dir or the nearest parent that has it.
+func findFile(dir, name string) (string, bool) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if info, err := os.Stat(filepath.Join(d, name)); err == nil && !info.IsDir() {
+			return filepath.Join(d, name), true
+		}
+		if filepath.Dir(d) == d {
+			return "", false
+		}
+	}
+}
+
+// modDirective is a single line of a go.mod or go.work file e.x `require github.com/go-services/code v0.1.11`,
+// directives in blocks are returned with the verb of the block.
+type modDirective struct {
+	verb string
+	args []string
+}
+
+func parseModDirectives(data string) (directives []modDirective) {
+	block := ""
+	for _, line := range strings.Split(data, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			directives = append(directives, modDirective{verb: block, args: unquoteFields(fields)})
+			continue
+		}
+		if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		if len(fields) > 1 {
+			directives = append(directives, modDirective{verb: fields[0], args: unquoteFields(fields[1:])})
+		}
+	}
+	return directives
+}
+
+func unquoteFields(fields []string) []string {
+	for i, f := range fields {
+		fields[i] = strings.Trim(f, "\"`")
+	}
+	return fields
+}
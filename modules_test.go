@@ -0,0 +1,65 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleBuildContext(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"app/go.mod": `module example.com/app
+
+go 1.18
+
+require (
+	github.com/BurntSushi/toml v1.2.0
+	github.com/go-services/code v0.1.11 // indirect
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+replace github.com/go-services/code => ../code
+`,
+		"app/internal/db/db.go": "package database\n",
+		"code/types.go":         "package code\n",
+		"cache/github.com/!burnt!sushi/toml@v1.2.0/toml.go": "package toml\n",
+		"cache/github.com/!burnt!sushi/toml@v1.2.0/doc.go":  "// +build ignore\n\npackage main\n",
+	})
+	defer os.RemoveAll(dir)
+	ctx, err := NewModuleBuildContext(filepath.Join(dir, "app", "internal"))
+	assert.NoError(t, err)
+	ctx.modCache = filepath.Join(dir, "cache")
+
+	cases := map[string]ImportInfo{
+		"example.com/app/internal/db":   {Dir: filepath.Join(dir, "app", "internal", "db"), Name: "database"},
+		"github.com/go-services/code":   {Dir: filepath.Join(dir, "code"), Name: "code"},
+		"github.com/BurntSushi/toml":    {Dir: filepath.Join(dir, "cache", "github.com", "!burnt!sushi", "toml@v1.2.0"), Name: "toml"},
+		"gopkg.in/yaml.v2":              {Name: "yaml"},
+		"github.com/mattn/go-sqlite3":   {Name: "sqlite3"},
+		"github.com/nats-io/nats.go":    {Name: "nats"},
+		"github.com/go-chi/chi/v5":      {Name: "chi"},
+		"github.com/aws/aws-sdk-go/aws": {Name: "aws"},
+	}
+	for path, expected := range cases {
+		info, err := ctx.Import(path)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, *info, path)
+	}
+	info, err := ctx.Import("strings")
+	assert.NoError(t, err)
+	assert.Equal(t, "strings", info.Name)
+	assert.NotEmpty(t, info.Dir)
+
+	src, err := New(`package app
+
+import "gopkg.in/yaml.v2"
+
+type Config struct {
+	Node yaml.Node
+}
+`, WithBuildContext(ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml", src.Imports()[0].Package())
+}
@@ -0,0 +1,465 @@
+package source
+
+import (
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-services/code"
+)
+
+// Package represents a parsed package, it aggregates the sources of every file in the package directory.
+type Package struct {
+	name string
+	dir  string
+
+	// the file paths sorted by name
+	files []string
+
+	// the parsed sources by file path
+	sources map[string]*Source
+}
+
+// NewPackage loads the package in the given directory, if path is not a directory it is
+// resolved as an import path using the build context.
+// Build contexts that implement FileSystem e.x MapBuildContext serve the files of the package.
+// Test files are only loaded when using WithTests, files excluded by build constraints are skipped.
+func NewPackage(path string, opts ...Option) (*Package, error) {
+	options := newOptions(opts...)
+	if options.importCache == nil {
+		// the files of a package usually import the same packages
+		opts = append(opts[:len(opts):len(opts)], WithImportCache(NewImportCache()))
+	}
+	fsys := newFileSystem(options.buildContext)
+	dir, err := resolvePackageDir(path, options.buildContext, fsys)
+	if err != nil {
+		return nil, err
+	}
+	ctx := fsys.buildContext(build.Default)
+	ctx.BuildTags = options.buildTags
+	entries, err := fsys.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &Package{
+		dir:     dir,
+		sources: map[string]*Source{},
+	}
+	var testSources []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".go") {
+			continue
+		}
+		isTest := strings.HasSuffix(e.Name(), "_test.go")
+		if isTest && !options.tests {
+			continue
+		}
+		match, err := ctx.MatchFile(dir, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+		pth := filepath.Join(dir, e.Name())
+		src, err := openFile(fsys, pth, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if isTest {
+			testSources = append(testSources, pth)
+		} else if pkg.name == "" {
+			pkg.name = src.Package()
+		} else if pkg.name != src.Package() {
+			return nil, fmt.Errorf("found packages `%s` and `%s` in `%s`", pkg.name, src.Package(), dir)
+		}
+		pkg.files = append(pkg.files, pth)
+		pkg.sources[pth] = src
+	}
+	// external test packages e.x `source_test` are a different package
+	for _, pth := range testSources {
+		if pkg.name != "" && pkg.sources[pth].Package() != pkg.name {
+			pkg.removeFile(pth)
+		} else if pkg.name == "" {
+			pkg.name = strings.TrimSuffix(pkg.sources[pth].Package(), "_test")
+		}
+	}
+	if len(pkg.files) == 0 {
+		return nil, fmt.Errorf("no go files found in `%s`", dir)
+	}
+	sort.Strings(pkg.files)
+	return pkg, nil
+}
+
+func resolvePackageDir(path string, buildContext BuildContext, fsys fileSystem) (string, error) {
+	dir := path
+	if !filepath.IsAbs(dir) {
+		cwd, err := buildContext.Cwd()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(cwd, dir)
+	}
+	if fsys.isDir(dir) {
+		return dir, nil
+	}
+	pkg, err := buildContext.Import(path)
+	if err != nil {
+		return "", err
+	}
+	if pkg.Dir == "" {
+		return "", &NotFoundError{Kind: "package", Name: path}
+	}
+	return pkg.Dir, nil
+}
+
+func (p *Package) removeFile(pth string) {
+	delete(p.sources, pth)
+	for i, f := range p.files {
+		if f == pth {
+			p.files = append(p.files[:i], p.files[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *Package) Name() string {
+	return p.name
+}
+
+func (p *Package) Dir() string {
+	return p.dir
+}
+
+// Files returns the paths of the loaded files sorted by name.
+func (p *Package) Files() []string {
+	return p.files
+}
+
+// Source returns the source of the given file, the file can be given as a path or as a file name.
+func (p *Package) Source(file string) (*Source, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(p.dir, file)
+	}
+	if src, ok := p.sources[file]; ok {
+		return src, nil
+	}
+	return nil, &NotFoundError{Kind: "file", Name: file, ParentKind: "package", Parent: p.name}
+}
+
+// sourceWith returns the first file, by name, that satisfies has.
+func (p *Package) sourceWith(has func(s *Source) error) (*Source, error) {
+	var err error
+	for _, f := range p.files {
+		if err = has(p.sources[f]); err == nil {
+			return p.sources[f], nil
+		}
+	}
+	return nil, err
+}
+
+// FileOf returns the path of the file that declares the top level declaration with the given name,
+// methods are named using the receiver type as prefix e.x `Repo.Get`.
+func (p *Package) FileOf(name string) (string, error) {
+	for _, f := range p.files {
+		if p.sources[f].lookup(name) != nil {
+			return f, nil
+		}
+	}
+	return "", &NotFoundError{Kind: "declaration", Name: name, ParentKind: "package", Parent: p.name}
+}
+
+// Lookup returns the top level declaration with the given name regardless of the file that declares it.
+func (p *Package) Lookup(name string) (Node, error) {
+	file, err := p.FileOf(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.sources[file].lookup(name), nil
+}
+
+// Decls returns the top level declarations of every file, files are sorted by name
+// and declarations are in the order they are declared in the file.
+func (p *Package) Decls() (decls []Decl) {
+	for _, f := range p.files {
+		decls = append(decls, p.sources[f].Decls()...)
+	}
+	return
+}
+
+// FindByAnnotation returns the nodes of every file with the given annotation, files are sorted by name.
+func (p *Package) FindByAnnotation(name string) (nodes []Node) {
+	for _, f := range p.files {
+		nodes = append(nodes, p.sources[f].FindByAnnotation(name)...)
+	}
+	return
+}
+
+// Diagnostics returns the diagnostics of every file, files are sorted by name.
+func (p *Package) Diagnostics() (diagnostics []Diagnostic) {
+	for _, f := range p.files {
+		diagnostics = append(diagnostics, p.sources[f].Diagnostics()...)
+	}
+	return
+}
+
+func (p *Package) Structures() (structures []Structure) {
+	for _, f := range p.files {
+		structures = append(structures, p.sources[f].Structures()...)
+	}
+	return
+}
+
+func (p *Package) Interfaces() (interfaces []Interface) {
+	for _, f := range p.files {
+		interfaces = append(interfaces, p.sources[f].Interfaces()...)
+	}
+	return
+}
+
+func (p *Package) Functions() (functions []Function) {
+	for _, f := range p.files {
+		functions = append(functions, p.sources[f].Functions()...)
+	}
+	return
+}
+
+func (p *Package) NamedTypes() (namedTypes []NamedType) {
+	for _, f := range p.files {
+		namedTypes = append(namedTypes, p.sources[f].NamedTypes()...)
+	}
+	return
+}
+
+func (p *Package) Constants() (constants []Constant) {
+	for _, f := range p.files {
+		constants = append(constants, p.sources[f].Constants()...)
+	}
+	return
+}
+
+func (p *Package) Variables() (variables []Variable) {
+	for _, f := range p.files {
+		variables = append(variables, p.sources[f].Variables()...)
+	}
+	return
+}
+
+func (p *Package) GetStructure(name string) (*Structure, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetStructure(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetStructure(name)
+}
+
+func (p *Package) GetInterface(name string) (*Interface, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetInterface(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetInterface(name)
+}
+
+// MethodSet returns every method of the interface including the methods of the interfaces it embeds,
+// embedded interfaces declared in any file of the package and `error` are resolved.
+// If an embedded interface can not be resolved the resolved methods are returned
+// together with an UnresolvedEmbedsError.
+func (p *Package) MethodSet(name string) ([]InterfaceMethod, error) {
+	inf, err := p.GetInterface(name)
+	if err != nil {
+		return nil, err
+	}
+	return resolvedMethodSet(inf, p.GetInterface)
+}
+
+func (p *Package) GetFunction(name string) (*Function, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetFunction(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetFunction(name)
+}
+
+func (p *Package) GetMethod(receiverType, name string) (*Function, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetMethod(receiverType, name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetMethod(receiverType, name)
+}
+
+func (p *Package) GetNamedType(name string) (*NamedType, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetNamedType(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetNamedType(name)
+}
+
+func (p *Package) GetConstant(name string) (*Constant, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetConstant(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetConstant(name)
+}
+
+func (p *Package) GetVariable(name string) (*Variable, error) {
+	src, err := p.sourceWith(func(s *Source) error {
+		_, err := s.GetVariable(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return src.GetVariable(name)
+}
+
+func (p *Package) AppendFieldToStruct(name string, field *code.StructField) error {
+	return p.edit(name, func(s *Source) error {
+		return s.AppendFieldToStruct(name, field)
+	})
+}
+
+func (p *Package) AppendMethodToInterface(name string, method code.InterfaceMethod) error {
+	return p.edit(name, func(s *Source) error {
+		return s.AppendMethodToInterface(name, method)
+	})
+}
+
+func (p *Package) AppendParameterToFunction(name string, param *code.Parameter) error {
+	return p.edit(name, func(s *Source) error {
+		return s.AppendParameterToFunction(name, param)
+	})
+}
+
+func (p *Package) AppendCodeToFunction(name string, method *code.RawCode) error {
+	return p.edit(name, func(s *Source) error {
+		return s.AppendCodeToFunction(name, method)
+	})
+}
+
+func (p *Package) SetFieldTag(name, field, key, value string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.SetFieldTag(name, field, key, value)
+	})
+}
+
+func (p *Package) SetFieldTags(name, field string, tags code.FieldTags) error {
+	return p.edit(name, func(s *Source) error {
+		return s.SetFieldTags(name, field, tags)
+	})
+}
+
+func (p *Package) RemoveFieldTag(name, field, key string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveFieldTag(name, field, key)
+	})
+}
+
+func (p *Package) AddFieldTags(name string, naming TagNaming, keys ...string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.AddFieldTags(name, naming, keys...)
+	})
+}
+
+func (p *Package) CommentInterface(inf, comment string) error {
+	return p.edit(inf, func(s *Source) error {
+		return s.CommentInterface(inf, comment)
+	})
+}
+
+func (p *Package) CommentInterfaceMethod(inf, method string, comment string) error {
+	return p.edit(inf, func(s *Source) error {
+		return s.CommentInterfaceMethod(inf, method, comment)
+	})
+}
+
+// RemoveUnusedImports removes the unused imports of every file of the package.
+func (p *Package) RemoveUnusedImports() error {
+	for _, f := range p.files {
+		if err := p.sources[f].RemoveUnusedImports(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes every modified file of the package to disk.
+func (p *Package) Save() error {
+	for _, f := range p.files {
+		if !p.sources[f].Modified() {
+			continue
+		}
+		if err := p.sources[f].Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// edit applies the edit to the file that declares name.
+func (p *Package) edit(name string, edit func(s *Source) error) error {
+	file, err := p.FileOf(name)
+	if err != nil {
+		return err
+	}
+	return edit(p.sources[file])
+}
+
+func (p *Package) RemoveStructure(name string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveStructure(name)
+	})
+}
+
+func (p *Package) RemoveInterface(name string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveInterface(name)
+	})
+}
+
+func (p *Package) RemoveFunction(name string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveFunction(name)
+	})
+}
+
+func (p *Package) RemoveFieldFromStruct(name, field string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveFieldFromStruct(name, field)
+	})
+}
+
+func (p *Package) RemoveMethodFromInterface(name, method string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveMethodFromInterface(name, method)
+	})
+}
+
+func (p *Package) RemoveParameterFromFunction(name, param string) error {
+	return p.edit(name, func(s *Source) error {
+		return s.RemoveParameterFromFunction(name, param)
+	})
+}
@@ -0,0 +1,125 @@
+package source
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-services/code"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePackage(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestNewPackage(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"service.go": `package users
+
+type Service interface {
+	Get(id string) (User, error)
+}
+`,
+		"user.go": `package users
+
+type User struct {
+	ID string
+}
+
+func (u User) Valid() bool {
+	return u.ID != ""
+}
+`,
+		"ignored.go": `//go:build ignore
+
+package users
+
+type Ignored struct{}
+`,
+		"user_test.go": `package users
+
+type fixture struct{}
+`,
+		"external_test.go": `package users_test
+
+type external struct{}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	pkg, err := NewPackage(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "users", pkg.Name())
+	assert.Len(t, pkg.Files(), 2)
+	assert.Len(t, pkg.Structures(), 1)
+
+	file, err := pkg.FileOf("User.Valid")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "user.go"), file)
+
+	assert.NoError(t, pkg.AppendFieldToStruct("User", code.NewStructField("Name", code.Type{Qualifier: "string"})))
+	user, err := pkg.GetStructure("User")
+	assert.NoError(t, err)
+	assert.Len(t, user.Fields(), 2)
+
+	_, err = pkg.GetStructure("Ignored")
+	assert.Error(t, err)
+
+	pkg, err = NewPackage(dir, WithTests())
+	assert.NoError(t, err)
+	assert.Len(t, pkg.Files(), 3)
+	_, err = pkg.GetStructure("fixture")
+	assert.NoError(t, err)
+}
+
+func TestNewPackageMapBuildContext(t *testing.T) {
+	ctx := MapBuildContext{
+		Dir: "/work",
+		Packages: map[string]ImportInfo{
+			"example.com/app/models": {Dir: "/work/models", Name: "models"},
+			"example.com/lib/v2":     {Name: "lib"},
+		},
+		FS: fstest.MapFS{
+			"work/models/user.go": {Data: []byte("package models\n\nimport \"example.com/lib/v2\"\n\ntype User struct {\n\tID lib.ID\n}\n")},
+			"work/models/mock.go": {Data: []byte("//go:build mock\n\npackage models\n\ntype Mock struct{}\n")},
+			"work/models/doc.txt": {Data: []byte("models")},
+		},
+	}
+	pkg, err := NewPackage("example.com/app/models", WithBuildContext(ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, "models", pkg.Name())
+	assert.Equal(t, []string{filepath.Join("/work/models", "user.go")}, pkg.Files())
+	src, err := pkg.Source("user.go")
+	assert.NoError(t, err)
+	assert.Equal(t, "lib", src.Imports()[0].Package())
+
+	// sources loaded from the fs can not be saved to the same path on disk
+	assert.NoError(t, pkg.AppendFieldToStruct("User", code.NewStructField("Name", code.Type{Qualifier: "string"})))
+	var readOnly *ReadOnlyError
+	assert.True(t, errors.As(src.Save(), &readOnly))
+	assert.Equal(t, filepath.Join("/work/models", "user.go"), readOnly.Path)
+	assert.True(t, errors.As(pkg.Save(), &readOnly))
+
+	pkg, err = NewPackage("models", WithBuildContext(ctx), WithBuildTags("mock"))
+	assert.NoError(t, err)
+	assert.Len(t, pkg.Files(), 2)
+
+	_, err = NewPackage("example.com/missing", WithBuildContext(ctx))
+	assert.True(t, errors.Is(err, &NotFoundError{Kind: "package", Name: "example.com/missing"}))
+}
@@ -13,6 +13,27 @@ import (
 
 type Options struct {
 	buildContext BuildContext
+
+	// include `_test.go` files when loading a package
+	tests bool
+
+	// the build tags used to match files when loading a package
+	buildTags []string
+
+	// return a parse error instead of skipping malformed or duplicate constructs
+	strict bool
+
+	// organize the imports when formatting the source, nil to keep them as they are
+	organizeImports *ImportOptions
+
+	// the cache of the resolved imports, nil to use a new cache for every source
+	importCache *ImportCache
+
+	// parse the whole source after every edit instead of the changed declaration
+	fullReparse bool
+
+	// format only the declarations changed since the source was parsed instead of the whole source
+	minimalEdits bool
 }
 
 type Option func(*Options)
@@ -23,43 +44,134 @@ func WithBuildContext(buildContext BuildContext) Option {
 	}
 }
 
+// WithTests includes `_test.go` files when loading a package.
+func WithTests() Option {
+	return func(o *Options) {
+		o.tests = true
+	}
+}
+
+// WithBuildTags sets the build tags used to evaluate build constraints when loading a package.
+func WithBuildTags(tags ...string) Option {
+	return func(o *Options) {
+		o.buildTags = tags
+	}
+}
+
+// WithStrict returns a parse error for every construct that would be skipped,
+// without it the skipped constructs are reported by Source.Diagnostics.
+func WithStrict() Option {
+	return func(o *Options) {
+		o.strict = true
+	}
+}
+
+// WithOrganizeImports organizes the imports every time the source is formatted using String,
+// see Source.OrganizeImports.
+func WithOrganizeImports(opts ImportOptions) Option {
+	return func(o *Options) {
+		o.organizeImports = &opts
+	}
+}
+
+// WithImportCache shares the import cache between the sources parsed with the option,
+// packages loaded with NewPackage share a cache by default.
+func WithImportCache(cache *ImportCache) Option {
+	return func(o *Options) {
+		o.importCache = cache
+	}
+}
+
+// WithFullReparse parses the whole source after every edit, by default only the changed
+// declaration is parsed again.
+func WithFullReparse() Option {
+	return func(o *Options) {
+		o.fullReparse = true
+	}
+}
+
+// WithMinimalEdits formats only the declarations that were changed when the source is formatted
+// using String, comments, blank lines and the formatting of the rest of the source are kept as written.
+func WithMinimalEdits() Option {
+	return func(o *Options) {
+		o.minimalEdits = true
+	}
+}
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		buildContext: DefaultBuildContext{},
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return options
+}
+
 type fileParser struct {
 	ast          *ast.File
 	file         *file
 	buildContext BuildContext
+
+	// the file name used for positions, defaults to `file.go`
+	filename string
+
+	// the token file of the parsed source, used to resolve the positions of nodes
+	tokenFile *token.File
+
+	strict          bool
+	organizeImports *ImportOptions
+	importCache     *ImportCache
+	fullReparse     bool
+	minimalEdits    bool
+	diagnostics     *diagnostics
 }
 type structParser struct {
-	imports []Import
+	imports     []Import
+	tokenFile   *token.File
+	diagnostics *diagnostics
 }
 type functionParser struct {
-	imports []Import
+	imports     []Import
+	tokenFile   *token.File
+	diagnostics *diagnostics
 }
 type interfaceParser struct {
-	imports []Import
+	imports     []Import
+	tokenFile   *token.File
+	diagnostics *diagnostics
 }
 
 func newParser(opts ...Option) *fileParser {
-	options := Options{
-		buildContext: DefaultBuildContext{},
-	}
-	for _, o := range opts {
-		o(&options)
-	}
-	return &fileParser{
+	options := newOptions(opts...)
+	p := &fileParser{
 		buildContext: options.buildContext,
+		filename:     "file.go",
+		strict:       options.strict,
+
+		organizeImports: options.organizeImports,
+		importCache:     options.importCache,
+		fullReparse:     options.fullReparse,
+		minimalEdits:    options.minimalEdits,
 	}
+	if p.importCache == nil {
+		p.importCache = NewImportCache()
+	}
+	return p
 }
 
 func (p *fileParser) parse(src string) (*file, error) {
 	// parse the source
 	fSet := token.NewFileSet()
-	astFile, err := parser.ParseFile(fSet, "file.go", src, parser.ParseComments)
+	astFile, err := parser.ParseFile(fSet, p.filename, src, parser.ParseComments)
 	if err != nil {
-		return nil, err
+		return nil, newParseError(src, err)
 	}
 
 	// store ast representation in file
 	p.ast = astFile
+	p.tokenFile = fSet.File(astFile.Pos())
+	p.diagnostics = &diagnostics{tokenFile: p.tokenFile}
 
 	// parse package
 	if p.ast.Name == nil {
@@ -72,34 +184,96 @@ func (p *fileParser) parse(src string) (*file, error) {
 
 	// parse code nodes
 	for _, d := range p.ast.Decls {
-		switch p.getType(d) {
-		case token.TYPE:
-			err := p.parseTypeSpec(d.(*ast.GenDecl))
-			if err != nil {
-				return nil, err
-			}
-		case token.FUNC:
-			function, err := p.parseFunction(d.(*ast.FuncDecl))
-			if err != nil {
-				return nil, err
-			}
-			// copy body from the source and add it to the function.
-			// this is just a simple way to get the body when using code.Function
-			innerBody := p.file.src[function.InnerBegin():function.InnerEnd()]
-			function.code.AddStringBody(strings.TrimSpace(innerBody))
-
-			// add the function
-			p.file.functions[function.Name()] = function
+		if err := p.parseDecl(d); err != nil {
+			return nil, err
 		}
 	}
+	p.associateMethods()
+	p.file.diagnostics = p.diagnostics.list
+	if p.strict && len(p.file.diagnostics) > 0 {
+		return nil, strictError(src, p.file.diagnostics)
+	}
 	return p.file, nil
 }
 
+// parseDecl parses the top level declaration and adds its nodes to the file.
+func (p *fileParser) parseDecl(d ast.Decl) error {
+	switch p.getType(d) {
+	case token.TYPE:
+		err := p.parseTypeSpec(d.(*ast.GenDecl))
+		if err != nil {
+			return err
+		}
+	case token.CONST:
+		p.parseConstants(d.(*ast.GenDecl))
+	case token.VAR:
+		p.parseVariables(d.(*ast.GenDecl))
+	case token.FUNC:
+		function, err := p.parseFunction(d.(*ast.FuncDecl))
+		if err != nil {
+			return err
+		}
+		// copy body from the source and add it to the function.
+		// this is just a simple way to get the body when using code.Function
+		innerBody := p.file.src[function.InnerBegin():function.InnerEnd()]
+		function.code.AddStringBody(strings.TrimSpace(innerBody))
+
+		// add the function
+		p.checkDuplicate(FunctionDecl, function.Key(), d.Pos())
+		p.file.record(FunctionDecl, function.Key())
+		p.file.functions[function.Key()] = function
+	default:
+		if _, ok := d.(*ast.BadDecl); ok {
+			p.diagnostics.report(d.Pos(), "declaration", "", "invalid declaration")
+		}
+	}
+	return nil
+}
+
+// checkDuplicate reports declarations that replace a previous declaration with the same name,
+// multiple `init` functions are valid go and are not reported.
+func (p *fileParser) checkDuplicate(kind DeclKind, key string, pos token.Pos) {
+	if key == "init" || p.file.node(declRef{kind: kind, key: key}) == nil {
+		return
+	}
+	p.diagnostics.report(pos, kind.String(), key, "duplicate declaration, only the last one is kept")
+}
+
+// associateMethods adds the parsed methods to the structures and named types they belong to.
+func (p *fileParser) associateMethods() {
+	// the methods are associated again after incremental parsing
+	for name, st := range p.file.structures {
+		st.methods = nil
+		p.file.structures[name] = st
+	}
+	for name, nt := range p.file.namedTypes {
+		nt.methods = nil
+		p.file.namedTypes[name] = nt
+	}
+	for _, ref := range p.file.order {
+		fn, ok := p.file.functions[ref.key]
+		if ref.kind != FunctionDecl || !ok || !fn.IsMethod() {
+			continue
+		}
+		if st, ok := p.file.structures[fn.ReceiverType()]; ok {
+			st.methods = append(st.methods, fn)
+			p.file.structures[fn.ReceiverType()] = st
+		} else if nt, ok := p.file.namedTypes[fn.ReceiverType()]; ok {
+			nt.methods = append(nt.methods, fn)
+			p.file.namedTypes[fn.ReceiverType()] = nt
+		}
+	}
+}
+
 func (p *fileParser) parseImports() (imports []Import) {
 	// find imports
 	for _, i := range p.ast.Imports {
 		imp := Import{
-			code: code.Import{},
+			ast:       i,
+			code:      code.Import{},
+			tokenFile: p.tokenFile,
+			begin:     int(i.Pos()) - 1,
+			end:       int(i.End()) - 1,
 		}
 		if i.Name != nil {
 			imp.code.Alias = i.Name.Name
@@ -109,7 +283,7 @@ func (p *fileParser) parseImports() (imports []Import) {
 		if err == nil {
 			imp.code.Path = pth
 		}
-		pkg, err := p.buildContext.Import(imp.code.Path)
+		pkg, err := p.importPackage(imp.code.Path)
 		if err == nil {
 			imp.code.FilePath = pkg.Dir
 			imp.pkg = pkg.Name
@@ -119,6 +293,11 @@ func (p *fileParser) parseImports() (imports []Import) {
 	return imports
 }
 
+// importPackage resolves the import path using the import cache.
+func (p *fileParser) importPackage(path string) (*ImportInfo, error) {
+	return p.importCache.Import(p.buildContext, path)
+}
+
 func (p *fileParser) isType(d ast.Decl) bool {
 	gDecl, ok := d.(*ast.GenDecl)
 	if !ok || gDecl.Tok != token.TYPE {
@@ -127,6 +306,14 @@ func (p *fileParser) isType(d ast.Decl) bool {
 	return true
 }
 
+func (p *fileParser) isValue(d ast.Decl) bool {
+	gDecl, ok := d.(*ast.GenDecl)
+	if !ok || (gDecl.Tok != token.CONST && gDecl.Tok != token.VAR) {
+		return false
+	}
+	return true
+}
+
 func (p *fileParser) isStructure(spec ast.Spec) bool {
 	tp, ok := spec.(*ast.TypeSpec)
 	if !ok {
@@ -169,6 +356,8 @@ func (p *fileParser) isFunction(d ast.Decl) bool {
 func (p *fileParser) getType(spec ast.Decl) token.Token {
 	if p.isType(spec) {
 		return token.TYPE
+	} else if p.isValue(spec) {
+		return spec.(*ast.GenDecl).Tok
 	} else if p.isFunction(spec) {
 		return token.FUNC
 	}
@@ -186,35 +375,149 @@ func (p *fileParser) parseTypeSpec(d *ast.GenDecl) error {
 			if err != nil {
 				return err
 			}
+			p.checkDuplicate(InterfaceDecl, ifc.Name(), tp.Pos())
+			p.file.record(InterfaceDecl, ifc.Name())
 			p.file.interfaces[ifc.Name()] = ifc
 		} else if p.isStructure(spec) {
 			structures, err := p.parseStructure(tp)
 			if err != nil {
 				return err
 			}
+			p.checkDuplicate(StructureDecl, structures.Name(), tp.Pos())
+			p.file.record(StructureDecl, structures.Name())
 			p.file.structures[structures.Name()] = structures
+		} else {
+			namedType := p.parseNamedType(tp)
+			p.checkDuplicate(NamedTypeDecl, namedType.Name(), tp.Pos())
+			p.file.record(NamedTypeDecl, namedType.Name())
+			p.file.namedTypes[namedType.Name()] = namedType
 		}
 	}
 	return nil
 }
 
+func (p *fileParser) parseNamedType(spec *ast.TypeSpec) NamedType {
+	tp := parseType(spec.Type, p.file.imports)
+	return NamedType{
+		exported:   ast.IsExported(spec.Name.Name),
+		ast:        spec,
+		name:       spec.Name.Name,
+		alias:      spec.Assign != token.NoPos,
+		tp:         *tp,
+		typeParams: parseTypeParams(spec.TypeParams, p.file.imports),
+		docs:       parseComments(spec.Doc),
+		tokenFile:  p.tokenFile,
+		begin:      int(spec.Pos()) - 1,
+		end:        int(spec.End()) - 1,
+	}
+}
+
+func (p *fileParser) parseConstants(d *ast.GenDecl) {
+	enum := false
+	for _, spec := range d.Specs {
+		if len(spec.(*ast.ValueSpec).Values) > 0 && usesIota(spec.(*ast.ValueSpec).Values[0]) {
+			enum = true
+		}
+	}
+	// constants in a group that omit the type and value repeat the previous ones
+	var tp ast.Expr
+	var values []ast.Expr
+	for i, spec := range d.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if len(d.Specs) == 1 && vs.Doc == nil {
+			vs.Doc = d.Doc
+		}
+		if len(vs.Values) > 0 {
+			tp, values = vs.Type, vs.Values
+		}
+		for j, n := range vs.Names {
+			if n.Name == "_" {
+				continue
+			}
+			c := Constant{
+				exported:  ast.IsExported(n.Name),
+				name:      n.Name,
+				decl:      d,
+				spec:      vs,
+				iota:      i,
+				enum:      enum,
+				docs:      parseComments(vs.Doc),
+				tokenFile: p.tokenFile,
+				begin:     int(vs.Pos()) - 1,
+				end:       int(vs.End()) - 1,
+			}
+			if tp != nil {
+				c.tp = parseType(tp, p.file.imports)
+			}
+			if j < len(values) {
+				c.value = p.file.src[values[j].Pos()-1 : values[j].End()-1]
+			}
+			p.checkDuplicate(ConstantDecl, c.Name(), n.Pos())
+			p.file.record(ConstantDecl, c.Name())
+			p.file.constants[c.Name()] = c
+		}
+	}
+}
+
+func (p *fileParser) parseVariables(d *ast.GenDecl) {
+	for _, spec := range d.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if len(d.Specs) == 1 && vs.Doc == nil {
+			vs.Doc = d.Doc
+		}
+		for j, n := range vs.Names {
+			if n.Name == "_" {
+				continue
+			}
+			v := Variable{
+				exported:  ast.IsExported(n.Name),
+				name:      n.Name,
+				decl:      d,
+				spec:      vs,
+				docs:      parseComments(vs.Doc),
+				tokenFile: p.tokenFile,
+				begin:     int(vs.Pos()) - 1,
+				end:       int(vs.End()) - 1,
+			}
+			if vs.Type != nil {
+				v.tp = parseType(vs.Type, p.file.imports)
+			}
+			if len(vs.Values) == len(vs.Names) {
+				v.value = p.file.src[vs.Values[j].Pos()-1 : vs.Values[j].End()-1]
+			} else if len(vs.Values) > 0 {
+				// multiple variables assigned from a single call e.x `var a, b = f()`
+				v.value = p.file.src[vs.Values[0].Pos()-1 : vs.Values[len(vs.Values)-1].End()-1]
+			}
+			p.checkDuplicate(VariableDecl, v.Name(), n.Pos())
+			p.file.record(VariableDecl, v.Name())
+			p.file.variables[v.Name()] = v
+		}
+	}
+}
+
 func (p *fileParser) parseFunction(d *ast.FuncDecl) (Function, error) {
 	fp := &functionParser{
-		imports: p.file.imports,
+		imports:     p.file.imports,
+		tokenFile:   p.tokenFile,
+		diagnostics: p.diagnostics,
 	}
 	return fp.Parse(d)
 }
 
 func (p *fileParser) parseStructure(spec *ast.TypeSpec) (Structure, error) {
 	sp := &structParser{
-		imports: p.file.imports,
+		imports:     p.file.imports,
+		tokenFile:   p.tokenFile,
+		diagnostics: p.diagnostics,
 	}
 	return sp.Parse(spec)
 }
 
 func (p *fileParser) parseInterface(spec *ast.TypeSpec) (Interface, error) {
 	ip := &interfaceParser{
-		imports: p.file.imports,
+		imports:     p.file.imports,
+		tokenFile:   p.tokenFile,
+		diagnostics: p.diagnostics,
 	}
 	return ip.Parse(spec)
 }
@@ -230,10 +533,6 @@ func (f *functionParser) parseParams(params *ast.FieldList) []code.Parameter {
 		}
 
 		tp := parseType(p.Type, f.imports)
-		if tp == nil {
-			// type not supported
-			continue
-		}
 		if len(p.Names) == 0 {
 			prm := code.NewParameter("", *tp)
 			list = append(list, *prm)
@@ -249,9 +548,10 @@ func (f *functionParser) parseParams(params *ast.FieldList) []code.Parameter {
 
 func (f *functionParser) Parse(d *ast.FuncDecl) (Function, error) {
 	ft := Function{
-		ast:   d,
-		begin: int(d.Pos()) - 1,
-		end:   int(d.End()) - 1,
+		ast:       d,
+		tokenFile: f.tokenFile,
+		begin:     int(d.Pos()) - 1,
+		end:       int(d.End()) - 1,
 	}
 	if d.Body != nil {
 		ft.innerBegin = int(d.Body.Lbrace)
@@ -270,18 +570,21 @@ func (f *functionParser) Parse(d *ast.FuncDecl) (Function, error) {
 		code.DocsFunctionOption(parseComments(d.Doc)...),
 	)
 	ft.exported = ast.IsExported(d.Name.Name)
+	ft.typeParams = parseTypeParams(d.Type.TypeParams, f.imports)
 	if d.Recv != nil && len(d.Recv.List) > 0 {
 		ft.code.Recv = &f.parseParams(d.Recv)[0]
+		ft.receiverType = receiverTypeName(d.Recv.List[0].Type)
 	}
 	return ft, nil
 }
 
 func (s *structParser) Parse(tp *ast.TypeSpec) (Structure, error) {
 	st := Structure{
-		ast:    tp,
-		fields: []StructureField{},
-		begin:  int(tp.Pos()) - 1,
-		end:    int(tp.End()) - 1,
+		ast:       tp,
+		fields:    []StructureField{},
+		tokenFile: s.tokenFile,
+		begin:     int(tp.Pos()) - 1,
+		end:       int(tp.End()) - 1,
 	}
 	// get fields if any
 	fields := tp.Type.(*ast.StructType).Fields
@@ -297,15 +600,17 @@ func (s *structParser) Parse(tp *ast.TypeSpec) (Structure, error) {
 		parseComments(tp.Doc)...,
 	)
 	st.exported = ast.IsExported(tp.Name.Name)
+	st.typeParams = parseTypeParams(tp.TypeParams, s.imports)
 	st.fields = sfl
 	return st, nil
 }
 
 func (i *interfaceParser) Parse(tp *ast.TypeSpec) (Interface, error) {
 	inf := Interface{
-		ast:   tp,
-		begin: int(tp.Pos()) - 1,
-		end:   int(tp.End()) - 1,
+		ast:       tp,
+		tokenFile: i.tokenFile,
+		begin:     int(tp.Pos()) - 1,
+		end:       int(tp.End()) - 1,
 	}
 
 	// get fields if any
@@ -315,40 +620,47 @@ func (i *interfaceParser) Parse(tp *ast.TypeSpec) (Interface, error) {
 		inf.innerEnd = int(methods.Closing) - 1
 	}
 	// create the code representation
-	im, ims := i.parseInterfaceMethods(methods)
+	im, ims, embeds := i.parseInterfaceMethods(methods)
 	inf.code = *code.NewInterface(
 		tp.Name.Name,
 		im,
 		parseComments(tp.Doc)...,
 	)
 	inf.exported = ast.IsExported(tp.Name.Name)
+	inf.typeParams = parseTypeParams(tp.TypeParams, i.imports)
 	inf.methods = ims
+	inf.embeds = embeds
 	return inf, nil
 }
 
-func (i *interfaceParser) parseInterfaceMethods(methods *ast.FieldList) ([]code.InterfaceMethod, []InterfaceMethod) {
+func (i *interfaceParser) parseInterfaceMethods(methods *ast.FieldList) ([]code.InterfaceMethod, []InterfaceMethod, []code.Type) {
 	var list []code.InterfaceMethod
 	var sList []InterfaceMethod
+	var embeds []code.Type
 	if methods == nil {
-		return list, sList
+		return list, sList, embeds
 	}
 	for _, f := range methods.List {
-		tp, ok := f.Type.(*ast.FuncType)
-		if !ok {
+		if f == nil {
 			continue
 		}
-		if f == nil {
+		tp, ok := f.Type.(*ast.FuncType)
+		if !ok {
+			// embedded interfaces e.x `io.Reader` or type elements e.x `~int | ~string`
+			embeds = append(embeds, *parseType(f.Type, i.imports))
 			continue
 		}
 		for _, n := range f.Names {
 			mp := functionParser{
-				imports: i.imports,
+				imports:     i.imports,
+				diagnostics: i.diagnostics,
 			}
 			mth, err := mp.Parse(&ast.FuncDecl{
 				Name: n,
 				Type: tp,
 			})
 			if err != nil {
+				i.diagnostics.report(n.Pos(), "method", n.Name, err.Error())
 				continue
 			}
 			im := code.NewInterfaceMethod(
@@ -358,9 +670,11 @@ func (i *interfaceParser) parseInterfaceMethods(methods *ast.FieldList) ([]code.
 				code.DocsFunctionOption(parseComments(f.Doc)...),
 			)
 			ims := InterfaceMethod{
-				code:  im,
-				begin: int(f.Pos()) - 1,
-				end:   int(f.End()) - 1,
+				ast:       f,
+				code:      im,
+				tokenFile: i.tokenFile,
+				begin:     int(f.Pos()) - 1,
+				end:       int(f.End()) - 1,
 			}
 			ims.exported = ast.IsExported(n.Name)
 
@@ -368,7 +682,7 @@ func (i *interfaceParser) parseInterfaceMethods(methods *ast.FieldList) ([]code.
 			sList = append(sList, ims)
 		}
 	}
-	return list, sList
+	return list, sList, embeds
 }
 
 func (s *structParser) parseStructureFields(fields *ast.FieldList) ([]code.StructField, []StructureField) {
@@ -382,36 +696,36 @@ func (s *structParser) parseStructureFields(fields *ast.FieldList) ([]code.Struc
 			continue
 		}
 		tp := parseType(f.Type, s.imports)
-		if tp == nil {
-			// type not supported
-			continue
-		}
 		if len(f.Names) == 0 {
 			sf := code.NewStructField("", *tp, parseComments(f.Doc)...)
 			if f.Tag != nil && f.Tag.Kind == token.STRING {
-				// remove ` before parsing
-				sf.Tags = parseTags(f.Tag.Value[1 : len(f.Tag.Value)-1])
+				sf.Tags = s.parseFieldTags(f)
 			}
 			list = append(list, *sf)
 			stf := StructureField{
-				code:  *sf,
-				begin: int(f.Pos()) - 1,
-				end:   int(f.End()) - 1,
+				ast:       f,
+				code:      *sf,
+				embedded:  true,
+				tokenFile: s.tokenFile,
+				begin:     int(f.Pos()) - 1,
+				end:       int(f.End()) - 1,
 			}
+			stf.exported = ast.IsExported(stf.Name())
 			sList = append(sList, stf)
 			continue
 		}
 		for _, n := range f.Names {
 			sf := code.NewStructField(n.Name, *tp, parseComments(f.Doc)...)
 			if f.Tag != nil && f.Tag.Kind == token.STRING {
-				// remove ` before parsing
-				sf.Tags = parseTags(f.Tag.Value[1 : len(f.Tag.Value)-1])
+				sf.Tags = s.parseFieldTags(f)
 			}
 			list = append(list, *sf)
 			stf := StructureField{
-				code:  *sf,
-				begin: int(f.Pos()) - 1,
-				end:   int(f.End()) - 1,
+				ast:       f,
+				code:      *sf,
+				tokenFile: s.tokenFile,
+				begin:     int(f.Pos()) - 1,
+				end:       int(f.End()) - 1,
 			}
 			stf.exported = ast.IsExported(n.Name)
 			sList = append(sList, stf)
@@ -420,9 +734,30 @@ func (s *structParser) parseStructureFields(fields *ast.FieldList) ([]code.Struc
 	return list, sList
 }
 
-// this is copied and modified from https://golang.org/src/reflect/type.go?s=31821:31842#L1174
-func parseTags(tag string) *code.FieldTags {
+// parseFieldTags parses the tag of the field, tags after a syntax error are reported and skipped.
+func (s *structParser) parseFieldTags(f *ast.Field) *code.FieldTags {
+	tag, err := strconv.Unquote(f.Tag.Value)
+	tags, ok := parseTags(tag)
+	if err != nil || !ok {
+		s.diagnostics.report(f.Tag.Pos(), "field tag", fieldNames(f), "malformed struct tag")
+	}
+	return tags
+}
+
+// parseTags parses the tag into field tags, ok is false when a syntax error
+// stopped the parsing before the end of the tag.
+func parseTags(tag string) (*code.FieldTags, bool) {
 	tags := code.FieldTags{}
+	list, ok := parseTagList(tag)
+	for _, t := range list {
+		tags[t.key] = t.value
+	}
+	return &tags, ok
+}
+
+// parseTagList parses the tag keeping the order of the keys.
+// this is copied and modified from https://golang.org/src/reflect/type.go?s=31821:31842#L1174
+func parseTagList(tag string) (list []tagPair, ok bool) {
 	for tag != "" {
 		// Skip leading space.
 		i := 0
@@ -443,7 +778,7 @@ func parseTags(tag string) *code.FieldTags {
 			i++
 		}
 		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
-			break
+			return list, false
 		}
 		name := tag[:i]
 		tag = tag[i+1:]
@@ -457,15 +792,15 @@ func parseTags(tag string) *code.FieldTags {
 			i++
 		}
 		if i >= len(tag) {
-			break
+			return list, false
 		}
 		quotedValue := tag[:i+1]
 		value, err := strconv.Unquote(quotedValue)
 		if err != nil {
-			break
+			return list, false
 		}
-		tags[name] = value
+		list = append(list, tagPair{key: name, value: value, quoted: quotedValue})
 		tag = tag[i+1:]
 	}
-	return &tags
+	return list, true
 }
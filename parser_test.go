@@ -1,6 +1,14 @@
 package source
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dave/jennifer/jen"
+	"github.com/go-services/code"
+)
 
 func TestParser(t *testing.T) {
 	src, err := New(`
@@ -22,3 +30,344 @@ type XYZ struct {
 	}
 
 }
+
+func TestParserTypeParams(t *testing.T) {
+	src, err := New(`
+package source
+
+type Repo[T any] struct {
+	items []T
+	byID  Pair[string, T]
+}
+
+type Number interface {
+	~int | ~float64
+}
+
+func Map[K comparable, V any](in map[K]V, repo *Repo[V]) []V {
+	return nil
+}
+
+func Sum[N ~int | ~float64](n []N) N {
+	return 0
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := src.GetStructure("Repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.TypeParams()) != 1 || repo.TypeParams()[0].Name != "T" {
+		t.Fatalf("expected type param T, got %v", repo.TypeParams())
+	}
+	if repo.TypeParams()[0].Constraint.Qualifier != "any" {
+		t.Fatalf("expected constraint any, got %s", repo.TypeParams()[0].Constraint.Qualifier)
+	}
+	if len(repo.Fields()) != 2 {
+		t.Fatalf("expected 2 fields, got %d", len(repo.Fields()))
+	}
+
+	fn, err := src.GetFunction("Map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fn.TypeParams()) != 2 {
+		t.Fatalf("expected 2 type params, got %d", len(fn.TypeParams()))
+	}
+	if len(fn.Params()) != 2 {
+		t.Fatalf("expected 2 params, got %d", len(fn.Params()))
+	}
+	if fn.Params()[1].Type.RawType == nil {
+		t.Fatal("expected instantiated type to be represented by a raw type")
+	}
+
+	sum, err := src.GetFunction("Sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	terms := sum.TypeParams()[0].Terms
+	if len(terms) != 2 || !terms[0].Tilde || terms[1].Type.Qualifier != "float64" {
+		t.Fatalf("expected union terms ~int | ~float64, got %v", terms)
+	}
+}
+
+func TestParserNamedTypes(t *testing.T) {
+	src, err := New(`
+package source
+
+import "context"
+
+type Status int
+
+type Handler func(ctx context.Context) error
+
+type Tags map[string]string
+
+type ID = string
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(src.NamedTypes()) != 4 {
+		t.Fatalf("expected 4 named types, got %d", len(src.NamedTypes()))
+	}
+	status, err := src.GetNamedType("Status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.IsAlias() || status.Type().Qualifier != "int" {
+		t.Fatalf("expected Status to be defined as int, got %s", status.Type().Qualifier)
+	}
+	handler, err := src.GetNamedType("Handler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handler.Type().Function == nil || len(handler.Type().Function.Params) != 1 {
+		t.Fatal("expected Handler to be a function type with 1 parameter")
+	}
+	id, err := src.GetNamedType("ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.IsAlias() {
+		t.Fatal("expected ID to be an alias")
+	}
+}
+
+func TestParserPositions(t *testing.T) {
+	src, err := New(`package source
+
+import "context"
+
+type User struct {
+	ID   string
+	Name string
+}
+
+func Get(ctx context.Context) (User, error) {
+	return User{}, nil
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := src.GetStructure("User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := user.Position(); pos.Line != 5 || pos.Column != 6 {
+		t.Fatalf("expected structure at 5:6, got %s", pos)
+	}
+	if pos := user.EndPosition(); pos.Line != 8 || pos.Column != 2 {
+		t.Fatalf("expected structure to end at 8:2, got %s", pos)
+	}
+	if pos := user.Fields()[1].Position(); pos.Line != 7 || pos.Column != 2 {
+		t.Fatalf("expected field at 7:2, got %s", pos)
+	}
+	fn, err := src.GetFunction("Get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := fn.Position(); pos.Line != 10 || pos.Filename != "file.go" {
+		t.Fatalf("expected function at file.go:10, got %s", pos)
+	}
+	if pos := src.Imports()[0].Position(); pos.Line != 3 || pos.Column != 8 {
+		t.Fatalf("expected import at 3:8, got %s", pos)
+	}
+}
+
+func TestParserEmbedded(t *testing.T) {
+	src, err := New(`package source
+
+import "io"
+
+type Base struct{}
+
+type User struct {
+	Base
+	*io.PipeReader
+	Name string
+}
+
+type Getter interface {
+	Get(id string) (User, error)
+}
+
+type Service interface {
+	Getter
+	io.Closer
+	error
+	List() ([]User, error)
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := src.GetStructure("User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Fields()) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(user.Fields()))
+	}
+	if !user.Fields()[0].Embedded() || user.Fields()[0].Name() != "Base" {
+		t.Fatalf("expected embedded field Base, got %s", user.Fields()[0].Name())
+	}
+	if !user.Fields()[1].Embedded() || user.Fields()[1].Name() != "PipeReader" {
+		t.Fatalf("expected embedded field PipeReader, got %s", user.Fields()[1].Name())
+	}
+	if user.Fields()[2].Embedded() {
+		t.Fatal("expected Name not to be embedded")
+	}
+
+	service, err := src.GetInterface("Service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(service.Methods()) != 1 || len(service.Embeds()) != 3 {
+		t.Fatalf("expected 1 method and 3 embeds, got %d and %d", len(service.Methods()), len(service.Embeds()))
+	}
+	if service.Embeds()[1].Qualifier != "Closer" {
+		t.Fatalf("expected io.Closer to be embedded, got %s", service.Embeds()[1].Qualifier)
+	}
+	// io.Closer is declared in another package
+	methods, err := src.MethodSet("Service")
+	var unresolved *UnresolvedEmbedsError
+	if !errors.As(err, &unresolved) || strings.Join(unresolved.Embeds, ",") != "io.Closer" {
+		t.Fatalf("expected io.Closer to be unresolved, got %v", err)
+	}
+	var names []string
+	for _, m := range methods {
+		names = append(names, m.Name())
+	}
+	if strings.Join(names, ",") != "List,Get,Error" {
+		t.Fatalf("expected method set List,Get,Error got %s", strings.Join(names, ","))
+	}
+}
+
+func TestParserTypeCoverage(t *testing.T) {
+	src, err := New(`package source
+
+type Event struct{}
+
+type Option func()
+
+type Config struct {
+	Buffer  [4]byte
+	Events  chan<- Event
+	Nested  struct{ A int }
+	Handler interface{ Handle() }
+}
+
+func Listen(events <-chan Event, cfg struct{ A int }, ids [2]string, opts ...Option) {
+}
+
+func Close(
+	events chan Event,
+) {
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := src.GetStructure("Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Fields()) != 4 {
+		t.Fatalf("expected 4 fields, got %d", len(config.Fields()))
+	}
+	fn, err := src.GetFunction("Listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fn.Params()) != 4 {
+		t.Fatalf("expected 4 params, got %d", len(fn.Params()))
+	}
+	for i, expected := range []string{"<-chan Event", "struct{ A int }", "[2]string", "...Option"} {
+		tp := fn.Params()[i].Type
+		if tp.RawType == nil {
+			t.Fatalf("expected param %d to be a raw type", i)
+		}
+		if got := fmt.Sprintf("%#v", jen.Func().Id("_").Params(tp.RawType)); !strings.Contains(got, expected) {
+			t.Fatalf("expected param %d to contain `%s`, got `%s`", i, expected, got)
+		}
+	}
+
+	if err := src.AppendParameterToFunction("Close", code.NewParameter("force", code.Type{Qualifier: "bool"})); err != nil {
+		t.Fatal(err)
+	}
+	fn, err = src.GetFunction("Close")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fn.Params()) != 2 {
+		t.Fatalf("expected 2 params, got %d", len(fn.Params()))
+	}
+}
+
+func TestParserAnnotations(t *testing.T) {
+	src, err := New(`package source
+
+//abc:test 123
+type XYZ struct {
+	// @inject name="main db" optional
+	db string
+}
+
+// Service handles users.
+// @service
+type Service interface {
+	// @http method=GET path=/users/{id}
+	Get(id string) error
+	List() error
+}
+
+//go:generate mockgen -source=file.go
+/*
+ * @http method=POST path="/users"
+ */
+func Create() {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := src.GetStructure("XYZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := st.Annotations()
+	if len(a) != 1 || a[0].Name != "abc:test" || !a[0].Directive || len(a[0].Args) != 1 || a[0].Args[0] != "123" {
+		t.Fatalf("unexpected structure annotations %+v", a)
+	}
+	a = st.Fields()[0].Annotations()
+	if len(a) != 1 || a[0].Name != "inject" || a[0].Params["name"] != "main db" ||
+		len(a[0].Args) != 1 || a[0].Args[0] != "optional" || a[0].Position.Line != 5 {
+		t.Fatalf("unexpected field annotations %+v", a)
+	}
+	fn, err := src.GetFunction("Create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = fn.Annotations()
+	if len(a) != 2 || a[0].Name != "go:generate" || a[0].Args[1] != "-source=file.go" || a[1].Directive {
+		t.Fatalf("unexpected function annotations %+v", a)
+	}
+	if path, _ := a[1].Param("path"); path != "/users" {
+		t.Fatalf("expected path `/users`, got `%s`", path)
+	}
+
+	var names []string
+	for _, n := range src.FindByAnnotation("@http") {
+		names = append(names, n.Name())
+	}
+	if strings.Join(names, ",") != "Get,Create" {
+		t.Fatalf("expected nodes Get,Create got %v", names)
+	}
+	if len(src.FindByAnnotation("service")) != 1 {
+		t.Fatal("expected the service interface")
+	}
+}
@@ -0,0 +1,284 @@
+package source
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// RenameStructure renames the structure and every reference to it in the file
+// e.x composite literals, method receivers, parameters and variable types.
+func (s *Source) RenameStructure(name, newName string) error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	structure, err := s.GetStructure(name)
+	if err != nil {
+		return err
+	}
+	if err := s.checkDeclName("RenameStructure", name, newName); err != nil {
+		return err
+	}
+	s.file.src = renameIdents(s.file.src, s.declReferences(structure.ast), newName)
+	return s.parseAgain("RenameStructure")
+}
+
+// RenameInterface renames the interface and every reference to it in the file.
+func (s *Source) RenameInterface(name, newName string) error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	inf, err := s.GetInterface(name)
+	if err != nil {
+		return err
+	}
+	if err := s.checkDeclName("RenameInterface", name, newName); err != nil {
+		return err
+	}
+	s.file.src = renameIdents(s.file.src, s.declReferences(inf.ast), newName)
+	return s.parseAgain("RenameInterface")
+}
+
+// RenameFunction renames the function and every call to it in the file,
+// methods are renamed together with the selector expressions on values of the receiver type.
+func (s *Source) RenameFunction(name, newName string) error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	fn, err := s.GetFunction(name)
+	if err != nil {
+		return err
+	}
+	decl := fn.ast.(*ast.FuncDecl)
+	idents := []*ast.Ident{decl.Name}
+	if fn.IsMethod() {
+		if err := s.checkMemberName("RenameFunction", fn.ReceiverType(), fn.Name(), newName); err != nil {
+			return err
+		}
+		selectors, err := s.selectorReferences("RenameFunction", fn.Name(), decl.Name)
+		if err != nil {
+			return err
+		}
+		idents = append(idents, selectors...)
+	} else {
+		if err := s.checkDeclName("RenameFunction", name, newName); err != nil {
+			return err
+		}
+		idents = s.declReferences(decl)
+	}
+	s.file.src = renameIdents(s.file.src, idents, newName)
+	return s.parseAgain("RenameFunction")
+}
+
+// RenameField renames the structure field, selector expressions on values of the structure type
+// and the keys of composite literals of the structure.
+func (s *Source) RenameField(name, field, newName string) error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	structure, err := s.GetStructure(name)
+	if err != nil {
+		return err
+	}
+	for _, f := range structure.Fields() {
+		if f.Name() != field {
+			continue
+		}
+		if f.Embedded() {
+			return &UnsupportedError{Op: "RenameField", Name: field, Reason: "an embedded field can only be renamed by renaming its type"}
+		}
+		if err := s.checkMemberName("RenameField", name, field, newName); err != nil {
+			return err
+		}
+		id := f.ast.Names[nameIndex(f.ast.Names, field)]
+		selectors, err := s.selectorReferences("RenameField", field, id)
+		if err != nil {
+			return err
+		}
+		idents := append([]*ast.Ident{id}, selectors...)
+		idents = append(idents, s.compositeKeyReferences(name, field)...)
+		s.file.src = renameIdents(s.file.src, idents, newName)
+		return s.parseAgain("RenameField")
+	}
+	return &NotFoundError{Kind: "field", Name: field, ParentKind: "structure", Parent: name}
+}
+
+// RenameInterfaceMethod renames the interface method and selector expressions on values of the interface type.
+func (s *Source) RenameInterfaceMethod(name, method, newName string) error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	inf, err := s.GetInterface(name)
+	if err != nil {
+		return err
+	}
+	for _, m := range inf.Methods() {
+		if m.Name() != method {
+			continue
+		}
+		if err := s.checkMemberName("RenameInterfaceMethod", name, method, newName); err != nil {
+			return err
+		}
+		id := m.ast.Names[nameIndex(m.ast.Names, method)]
+		selectors, err := s.selectorReferences("RenameInterfaceMethod", method, id)
+		if err != nil {
+			return err
+		}
+		s.file.src = renameIdents(s.file.src, append([]*ast.Ident{id}, selectors...), newName)
+		return s.parseAgain("RenameInterfaceMethod")
+	}
+	return &NotFoundError{Kind: "method", Name: method, ParentKind: "interface", Parent: name}
+}
+
+// checkDeclName returns an UnsupportedError if the new name of a top level declaration is already
+// used in the file, the renamed references could refer to the other declaration or variable instead.
+func (s *Source) checkDeclName(op, name, newName string) error {
+	if newName != name && s.identNames()[newName] {
+		return &UnsupportedError{Op: op, Name: name, Reason: fmt.Sprintf("`%s` is already declared in the file", newName)}
+	}
+	return nil
+}
+
+// checkMemberName returns an UnsupportedError if the type already has a field or method with the new name.
+func (s *Source) checkMemberName(op, typeName, name, newName string) error {
+	if newName == name {
+		return nil
+	}
+	used := false
+	if _, ok := s.file.functions[functionKey(typeName, newName)]; ok {
+		used = true
+	}
+	if st, ok := s.file.structures[typeName]; ok {
+		for _, f := range st.Fields() {
+			used = used || f.Name() == newName
+		}
+	}
+	if inf, ok := s.file.interfaces[typeName]; ok {
+		for _, m := range inf.Methods() {
+			used = used || m.Name() == newName
+		}
+	}
+	if used {
+		return &UnsupportedError{Op: op, Name: name, Reason: fmt.Sprintf("`%s` is already declared on `%s`", newName, typeName)}
+	}
+	return nil
+}
+
+// declReferences returns every identifier in the file that refers to the declaration,
+// including the identifier that declares it.
+func (s *Source) declReferences(decl ast.Node) (idents []*ast.Ident) {
+	ast.Inspect(s.file.ast, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Obj != nil && id.Obj.Decl == decl {
+			idents = append(idents, id)
+		}
+		return true
+	})
+	return idents
+}
+
+// selectorReferences returns the selectors `x.sel` that select the field or method declared by the identifier,
+// the types of the values are found by type checking the file.
+// The types that are declared in other files or packages are not known, if one of the selectors with
+// the same name is on a value of an unknown type an UnsupportedError listing their positions is returned.
+func (s *Source) selectorReferences(op string, sel string, decl *ast.Ident) ([]*ast.Ident, error) {
+	info := s.typeInfo()
+	var idents []*ast.Ident
+	var unresolved []string
+	ast.Inspect(s.file.ast, func(n ast.Node) bool {
+		se, ok := n.(*ast.SelectorExpr)
+		if !ok || se.Sel.Name != sel {
+			return true
+		}
+		if selection, ok := info.Selections[se]; ok {
+			if selection.Obj().Pos() == decl.Pos() {
+				idents = append(idents, se.Sel)
+			}
+			return true
+		}
+		if x, ok := se.X.(*ast.Ident); ok {
+			if _, ok := info.Uses[x].(*types.PkgName); ok {
+				return true
+			}
+		}
+		if tv, ok := info.Types[se.X]; !ok || tv.Type == nil || tv.Type == types.Typ[types.Invalid] {
+			unresolved = append(unresolved, s.parser.tokenFile.Position(se.Sel.Pos()).String())
+		}
+		return true
+	})
+	if len(unresolved) > 0 {
+		return nil, &UnsupportedError{
+			Op:     op,
+			Name:   sel,
+			Reason: fmt.Sprintf("the type of the selectors at %s can not be resolved", strings.Join(unresolved, ", ")),
+		}
+	}
+	return idents, nil
+}
+
+// typeInfo type checks the file, the type errors are ignored.
+// Imported packages are empty, so the values of their types are not known.
+func (s *Source) typeInfo() *types.Info {
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+	}
+	conf := types.Config{
+		Importer: emptyImporter(s.packageName),
+		Error:    func(error) {},
+	}
+	// the positions of the ast are in the first file of its file set
+	fset := token.NewFileSet()
+	fset.AddFile(s.parser.filename, -1, len(s.file.src))
+	_, _ = conf.Check(s.file.pkg, fset, []*ast.File{s.file.ast}, info)
+	return info
+}
+
+// emptyImporter imports empty packages using the package names returned by the function.
+type emptyImporter func(path string) string
+
+func (i emptyImporter) Import(path string) (*types.Package, error) {
+	pkg := types.NewPackage(path, i(path))
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// compositeKeyReferences returns the keys of composite literals of the given type e.x `User{Name: ""}`.
+func (s *Source) compositeKeyReferences(typeName, key string) (idents []*ast.Ident) {
+	ast.Inspect(s.file.ast, func(n ast.Node) bool {
+		cl, ok := n.(*ast.CompositeLit)
+		if !ok || cl.Type == nil || receiverTypeName(cl.Type) != typeName {
+			return true
+		}
+		for _, e := range cl.Elts {
+			kv, ok := e.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if id, ok := kv.Key.(*ast.Ident); ok && id.Name == key {
+				idents = append(idents, id)
+			}
+		}
+		return true
+	})
+	return idents
+}
+
+// renameIdents replaces the identifiers with the new name, starting from the end of the file
+// so the positions of the identifiers that are not replaced yet stay valid.
+func renameIdents(src string, idents []*ast.Ident, name string) string {
+	sort.Slice(idents, func(i, j int) bool {
+		return idents[i].Pos() > idents[j].Pos()
+	})
+	for i, id := range idents {
+		if i > 0 && idents[i-1].Pos() == id.Pos() {
+			continue
+		}
+		begin := int(id.Pos()) - 1
+		src = src[:begin] + name + src[begin+len(id.Name):]
+	}
+	return src
+}
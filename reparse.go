@@ -0,0 +1,625 @@
+package source
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// reparse parses only the top level declaration changed from f.parsedSrc to src, the positions of the
+// following declarations are shifted instead of parsed again.
+// ok is false when the change can not be parsed incrementally e.x when it changes the imports,
+// more than one declaration or a declaration with diagnostics, the source must be parsed again.
+func (p *fileParser) reparse(f *file, src string) (*file, bool) {
+	if p.fullReparse || len(f.diagnostics) > 0 || src == f.parsedSrc {
+		return nil, false
+	}
+	edit := diffEdit(f.parsedSrc, src)
+	index, begin, end := declExtent(f, edit)
+	if index < 0 {
+		return nil, false
+	}
+	delta := len(edit.Text) - edit.Length
+
+	// parse the declaration alone, the padding keeps the offsets of the whole source
+	const pkg = "package p\n"
+	if begin < len(pkg) {
+		return nil, false
+	}
+	snippet := pkg + strings.Repeat(" ", begin-len(pkg)) + src[begin:end+delta]
+	astFile, err := parser.ParseFile(token.NewFileSet(), p.filename, snippet, parser.ParseComments)
+	if err != nil || len(astFile.Decls) != 1 {
+		return nil, false
+	}
+	decl := astFile.Decls[0]
+	if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+		return nil, false
+	}
+
+	fset := token.NewFileSet()
+	tokenFile := fset.AddFile(p.filename, -1, len(src))
+	tokenFile.SetLinesForContent([]byte(src))
+
+	// parse the nodes of the declaration in a separate file so the source is not changed
+	// if the declaration can not be parsed incrementally
+	dp := &fileParser{
+		buildContext: p.buildContext,
+		filename:     p.filename,
+		tokenFile:    tokenFile,
+		importCache:  p.importCache,
+		diagnostics:  &diagnostics{tokenFile: tokenFile},
+		file:         newFile(f.pkg, src, f.ast),
+	}
+	dp.file.imports = f.imports
+	if err := dp.parseDecl(decl); err != nil || len(dp.diagnostics.list) > 0 {
+		return nil, false
+	}
+	old := f.ast.Decls[index]
+	removed := map[declRef]bool{}
+	for _, ref := range f.order {
+		if b := f.node(ref).Begin(); b >= int(old.Pos())-1 && b < int(old.End())-1 {
+			removed[ref] = true
+		}
+	}
+	for _, ref := range dp.file.order {
+		// a declaration with the same name is declared somewhere else
+		if f.node(ref) != nil && !removed[ref] {
+			return nil, false
+		}
+	}
+
+	// the file is copied since nodes and transactions may still reference it,
+	// only the declarations and comments after the edit are copied with their positions shifted
+	c := newPosCopier(token.Pos(end+1), delta)
+	var comments []*ast.CommentGroup
+	for _, cg := range f.ast.Comments {
+		switch {
+		case int(cg.End())-1 <= begin:
+			comments = append(comments, cg)
+		case int(cg.Pos())-1 >= end:
+			comments = append(comments, c.comment(cg))
+		}
+	}
+	decls := make([]ast.Decl, len(f.ast.Decls))
+	copy(decls, f.ast.Decls[:index])
+	decls[index] = decl
+	for i, d := range f.ast.Decls[index+1:] {
+		decls[index+1+i] = c.copy(d).(ast.Decl)
+	}
+	scope := ast.NewScope(f.ast.Scope.Outer)
+	for name, obj := range f.ast.Scope.Objects {
+		if n, ok := obj.Decl.(ast.Node); ok && n.Pos() >= old.Pos() && n.End() <= old.End() {
+			continue
+		}
+		scope.Objects[name] = c.object(obj)
+	}
+	for name, obj := range astFile.Scope.Objects {
+		scope.Objects[name] = obj
+	}
+	c.finish()
+	fileAst := *f.ast
+	fileAst.Decls = decls
+	fileAst.Comments = insertComments(comments, astFile.Comments)
+	fileAst.Scope = scope
+	// identifiers of the declaration that reference other declarations are not resolved,
+	// the file stays incremental until it is resolved by parsing it again
+	fileAst.Unresolved = nil
+	c.shiftFields(&fileAst)
+
+	// update the nodes
+	var order []declRef
+	inserted := false
+	for _, ref := range f.order {
+		if removed[ref] {
+			continue
+		}
+		if !inserted && f.node(ref).Begin() >= begin {
+			order = append(order, dp.file.order...)
+			inserted = true
+		}
+		order = append(order, ref)
+	}
+	if !inserted {
+		order = append(order, dp.file.order...)
+	}
+	nf := f.shift(end, delta, tokenFile, c)
+	for ref := range removed {
+		nf.remove(ref)
+	}
+	for _, ref := range dp.file.order {
+		nf.add(ref, dp.file.node(ref))
+	}
+	nf.ast = &fileAst
+	nf.order = order
+	nf.incremental = true
+
+	p.file = nf
+	p.ast = nf.ast
+	p.tokenFile = tokenFile
+	p.associateMethods()
+	return nf, true
+}
+
+// declExtent returns the index of the declaration that contains the edit and the offsets of the
+// beginning of its docs and the end of its last line, index is -1 if no declaration contains the edit.
+// Import declarations and lines with more than one declaration are not used.
+func declExtent(f *file, edit TextEdit) (index, begin, end int) {
+	src := f.parsedSrc
+	for i, d := range f.ast.Decls {
+		begin = int(d.Pos()) - 1
+		if doc := declDoc(d); doc != nil {
+			begin = int(doc.Pos()) - 1
+		}
+		end = strings.IndexByte(src[int(d.End())-1:], '\n')
+		if end < 0 {
+			end = len(src)
+		} else {
+			end += int(d.End()) - 1
+		}
+		if edit.Offset < begin || edit.Offset+edit.Length > end {
+			continue
+		}
+		if gd, ok := d.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			return -1, 0, 0
+		}
+		// the declaration must be the only one on its lines
+		lineBegin := strings.LastIndexByte(src[:begin], '\n') + 1
+		if strings.TrimSpace(src[lineBegin:begin]) != "" {
+			return -1, 0, 0
+		}
+		if i+1 < len(f.ast.Decls) && int(f.ast.Decls[i+1].Pos())-1 < end {
+			return -1, 0, 0
+		}
+		return i, begin, end
+	}
+	return -1, 0, 0
+}
+
+func declDoc(d ast.Decl) *ast.CommentGroup {
+	switch d := d.(type) {
+	case *ast.GenDecl:
+		return d.Doc
+	case *ast.FuncDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// insertComments inserts the comments of a declaration in the sorted comments of the file.
+func insertComments(comments, decl []*ast.CommentGroup) []*ast.CommentGroup {
+	if len(decl) == 0 {
+		return comments
+	}
+	i := 0
+	for i < len(comments) && comments[i].Pos() < decl[0].Pos() {
+		i++
+	}
+	result := make([]*ast.CommentGroup, 0, len(comments)+len(decl))
+	result = append(result, comments[:i]...)
+	result = append(result, decl...)
+	return append(result, comments[i:]...)
+}
+
+var posType = reflect.TypeOf(token.NoPos)
+
+// posCopier copies ast nodes and moves the positions that are at or after from by delta.
+// Comment groups and objects are referenced more than once e.x by the comments of the file and
+// the docs of a declaration, they are copied once so the copies reference the same values.
+type posCopier struct {
+	from  token.Pos
+	delta int
+
+	comments map[*ast.CommentGroup]*ast.CommentGroup
+	objects  map[*ast.Object]*ast.Object
+
+	// the copies of the nodes that objects and the nodes of the file reference
+	nodes map[interface{}]interface{}
+}
+
+func newPosCopier(from token.Pos, delta int) *posCopier {
+	return &posCopier{
+		from:     from,
+		delta:    delta,
+		comments: map[*ast.CommentGroup]*ast.CommentGroup{},
+		objects:  map[*ast.Object]*ast.Object{},
+		nodes:    map[interface{}]interface{}{},
+	}
+}
+
+func (c *posCopier) pos(pos token.Pos) token.Pos {
+	if pos.IsValid() && pos >= c.from {
+		return pos + token.Pos(c.delta)
+	}
+	return pos
+}
+
+func (c *posCopier) comment(cg *ast.CommentGroup) *ast.CommentGroup {
+	if cp, ok := c.comments[cg]; ok {
+		return cp
+	}
+	cp := &ast.CommentGroup{List: make([]*ast.Comment, len(cg.List))}
+	for i, cm := range cg.List {
+		cp.List[i] = &ast.Comment{Slash: c.pos(cm.Slash), Text: cm.Text}
+	}
+	c.comments[cg] = cp
+	return cp
+}
+
+// object copies the object, the declaration of the copy is set by finish.
+func (c *posCopier) object(obj *ast.Object) *ast.Object {
+	if cp, ok := c.objects[obj]; ok {
+		return cp
+	}
+	cp := *obj
+	c.objects[obj] = &cp
+	return &cp
+}
+
+// node returns the copy of the node or the node if it was not copied.
+func (c *posCopier) node(n interface{}) interface{} {
+	if cp, ok := c.nodes[n]; ok {
+		return cp
+	}
+	return n
+}
+
+// finish points the copied objects to the copies of their declarations.
+func (c *posCopier) finish() {
+	for _, obj := range c.objects {
+		obj.Decl = c.node(obj.Decl)
+	}
+}
+
+// copy returns a copy of the node, the nodes that are referenced by objects or by the nodes
+// of the file are recorded so the references can be changed to the copies.
+func (c *posCopier) copy(n ast.Node) ast.Node {
+	cp := c.copyNode(n)
+	switch n.(type) {
+	case *ast.GenDecl, *ast.FuncDecl, *ast.TypeSpec, *ast.ValueSpec, *ast.ImportSpec,
+		*ast.Field, *ast.AssignStmt, *ast.LabeledStmt:
+		c.nodes[n] = cp
+	}
+	return cp
+}
+
+// copyNode copies the most common nodes directly and the others using reflection,
+// the positions of the direct copies are shifted using reflection so no position is missed.
+func (c *posCopier) copyNode(n ast.Node) ast.Node {
+	switch n := n.(type) {
+	case *ast.Ident:
+		return c.ident(n)
+	case *ast.BasicLit:
+		cp := *n
+		c.shiftFields(&cp)
+		return &cp
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: c.expr(n.X), Sel: c.ident(n.Sel)}
+	case *ast.StarExpr:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.X = c.expr(n.X)
+		return &cp
+	case *ast.Field:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.Doc = c.commentGroup(n.Doc)
+		cp.Type = c.expr(n.Type)
+		cp.Comment = c.commentGroup(n.Comment)
+		if n.Names != nil {
+			cp.Names = make([]*ast.Ident, len(n.Names))
+			for i, id := range n.Names {
+				cp.Names[i] = c.ident(id)
+			}
+		}
+		if n.Tag != nil {
+			cp.Tag = c.copyNode(n.Tag).(*ast.BasicLit)
+		}
+		return &cp
+	case *ast.FieldList:
+		return c.fieldList(n)
+	case *ast.StructType:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.Fields = c.fieldList(n.Fields)
+		return &cp
+	case *ast.InterfaceType:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.Methods = c.fieldList(n.Methods)
+		return &cp
+	case *ast.FuncType:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.TypeParams = c.fieldList(n.TypeParams)
+		cp.Params = c.fieldList(n.Params)
+		cp.Results = c.fieldList(n.Results)
+		return &cp
+	case *ast.TypeSpec:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.Doc = c.commentGroup(n.Doc)
+		cp.Name = c.ident(n.Name)
+		cp.TypeParams = c.fieldList(n.TypeParams)
+		cp.Type = c.expr(n.Type)
+		cp.Comment = c.commentGroup(n.Comment)
+		return &cp
+	case *ast.GenDecl:
+		cp := *n
+		c.shiftFields(&cp)
+		cp.Doc = c.commentGroup(n.Doc)
+		cp.Specs = make([]ast.Spec, len(n.Specs))
+		for i, spec := range n.Specs {
+			cp.Specs[i] = c.copy(spec).(ast.Spec)
+		}
+		return &cp
+	case *ast.FuncDecl:
+		cp := *n
+		cp.Doc = c.commentGroup(n.Doc)
+		cp.Recv = c.fieldList(n.Recv)
+		cp.Name = c.ident(n.Name)
+		cp.Type = c.copy(n.Type).(*ast.FuncType)
+		if n.Body != nil {
+			cp.Body = c.copy(n.Body).(*ast.BlockStmt)
+		}
+		return &cp
+	case *ast.BlockStmt:
+		cp := *n
+		c.shiftFields(&cp)
+		if n.List != nil {
+			cp.List = make([]ast.Stmt, len(n.List))
+			for i, stmt := range n.List {
+				cp.List[i] = c.copy(stmt).(ast.Stmt)
+			}
+		}
+		return &cp
+	case *ast.CommentGroup:
+		return c.commentGroup(n)
+	}
+	v := reflect.ValueOf(n)
+	cp := reflect.New(v.Type().Elem())
+	cp.Elem().Set(v.Elem())
+	c.copyFields(cp.Elem())
+	return cp.Interface().(ast.Node)
+}
+
+func (c *posCopier) ident(id *ast.Ident) *ast.Ident {
+	if id == nil {
+		return nil
+	}
+	cp := &ast.Ident{NamePos: c.pos(id.NamePos), Name: id.Name}
+	if id.Obj != nil {
+		cp.Obj = c.object(id.Obj)
+	}
+	return cp
+}
+
+func (c *posCopier) fieldList(fl *ast.FieldList) *ast.FieldList {
+	if fl == nil {
+		return nil
+	}
+	cp := *fl
+	c.shiftFields(&cp)
+	if fl.List != nil {
+		cp.List = make([]*ast.Field, len(fl.List))
+		for i, f := range fl.List {
+			cp.List[i] = c.copy(f).(*ast.Field)
+		}
+	}
+	return &cp
+}
+
+func (c *posCopier) expr(e ast.Expr) ast.Expr {
+	if e == nil {
+		return nil
+	}
+	return c.copy(e).(ast.Expr)
+}
+
+func (c *posCopier) commentGroup(cg *ast.CommentGroup) *ast.CommentGroup {
+	if cg == nil {
+		return nil
+	}
+	return c.comment(cg)
+}
+
+// copyFields replaces the fields of the struct copy with copies and shifts its positions.
+func (c *posCopier) copyFields(v reflect.Value) {
+	for _, f := range copyPlanOf(v.Type()) {
+		field := v.Field(f.index)
+		switch {
+		case f.pos:
+			field.SetInt(int64(c.pos(token.Pos(field.Int()))))
+		case field.IsNil():
+		case field.Kind() == reflect.Slice:
+			cp := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			for i := 0; i < field.Len(); i++ {
+				if e := field.Index(i); !e.IsNil() {
+					cp.Index(i).Set(c.copyValue(e))
+				}
+			}
+			field.Set(cp)
+		default:
+			field.Set(c.copyValue(field))
+		}
+	}
+}
+
+// copyValue copies a node, object or scope referenced by a field.
+func (c *posCopier) copyValue(v reflect.Value) reflect.Value {
+	switch n := v.Interface().(type) {
+	case *ast.Object:
+		return reflect.ValueOf(c.object(n))
+	case *ast.Scope:
+		return v
+	case ast.Node:
+		return reflect.ValueOf(c.copy(n))
+	}
+	return v
+}
+
+// shiftFields shifts the positions of the struct the pointer points to without copying its children.
+func (c *posCopier) shiftFields(ptr interface{}) {
+	v := reflect.ValueOf(ptr).Elem()
+	for _, f := range copyPlanOf(v.Type()) {
+		if f.pos {
+			field := v.Field(f.index)
+			field.SetInt(int64(c.pos(token.Pos(field.Int()))))
+		}
+	}
+}
+
+// copyField is a field of an ast node that is changed when the node is copied.
+type copyField struct {
+	index int
+	pos   bool
+}
+
+var copyPlans sync.Map
+
+// copyPlanOf returns the position, pointer, interface and slice fields of the struct type.
+func copyPlanOf(t reflect.Type) []copyField {
+	if plan, ok := copyPlans.Load(t); ok {
+		return plan.([]copyField)
+	}
+	var plan []copyField
+	for i := 0; i < t.NumField(); i++ {
+		switch ft := t.Field(i).Type; {
+		case ft == posType:
+			plan = append(plan, copyField{index: i, pos: true})
+		case ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Interface || ft.Kind() == reflect.Slice:
+			plan = append(plan, copyField{index: i})
+		}
+	}
+	copyPlans.Store(t, plan)
+	return plan
+}
+
+// resolve parses the whole source again if it was parsed incrementally, incremental parsing
+// does not resolve the identifiers that reference declarations in other declarations.
+// The source of a transaction is resolved when the transaction begins.
+func (s *Source) resolve() error {
+	if s.tx != nil || !s.file.incremental {
+		return nil
+	}
+	f, err := s.parser.parse(s.file.parsedSrc)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+func (f *file) remove(ref declRef) {
+	switch ref.kind {
+	case StructureDecl:
+		delete(f.structures, ref.key)
+	case InterfaceDecl:
+		delete(f.interfaces, ref.key)
+	case FunctionDecl:
+		delete(f.functions, ref.key)
+	case NamedTypeDecl:
+		delete(f.namedTypes, ref.key)
+	case ConstantDecl:
+		delete(f.constants, ref.key)
+	case VariableDecl:
+		delete(f.variables, ref.key)
+	}
+}
+
+func (f *file) add(ref declRef, node Node) {
+	switch n := node.(type) {
+	case Structure:
+		f.structures[ref.key] = n
+	case Interface:
+		f.interfaces[ref.key] = n
+	case Function:
+		f.functions[ref.key] = n
+	case NamedType:
+		f.namedTypes[ref.key] = n
+	case Constant:
+		f.constants[ref.key] = n
+	case Variable:
+		f.variables[ref.key] = n
+	}
+}
+
+// shift returns a copy of the file with delta added to the offsets of the nodes that are at or after from,
+// the nodes use the token file and the ast nodes copied by c.
+func (f *file) shift(from, delta int, tokenFile *token.File, c *posCopier) *file {
+	nf := newFile(f.pkg, f.src, f.ast)
+	nf.order = f.order
+	nf.imports = make([]Import, len(f.imports))
+	for i, imp := range f.imports {
+		imp.tokenFile = tokenFile
+		imp.ast = c.node(imp.ast).(*ast.ImportSpec)
+		shiftOffsets(from, delta, &imp.begin, &imp.end)
+		nf.imports[i] = imp
+	}
+	for k, n := range f.structures {
+		n.tokenFile = tokenFile
+		n.ast = c.node(n.ast).(*ast.TypeSpec)
+		shiftOffsets(from, delta, &n.begin, &n.end, &n.innerBegin, &n.innerEnd)
+		fields := make([]StructureField, len(n.fields))
+		for i, fl := range n.fields {
+			fl.tokenFile = tokenFile
+			fl.ast = c.node(fl.ast).(*ast.Field)
+			shiftOffsets(from, delta, &fl.begin, &fl.end)
+			fields[i] = fl
+		}
+		n.fields = fields
+		nf.structures[k] = n
+	}
+	for k, n := range f.interfaces {
+		n.tokenFile = tokenFile
+		n.ast = c.node(n.ast).(*ast.TypeSpec)
+		shiftOffsets(from, delta, &n.begin, &n.end, &n.innerBegin, &n.innerEnd)
+		methods := make([]InterfaceMethod, len(n.methods))
+		for i, m := range n.methods {
+			m.tokenFile = tokenFile
+			m.ast = c.node(m.ast).(*ast.Field)
+			shiftOffsets(from, delta, &m.begin, &m.end)
+			methods[i] = m
+		}
+		n.methods = methods
+		nf.interfaces[k] = n
+	}
+	for k, n := range f.functions {
+		n.tokenFile = tokenFile
+		n.ast = c.node(n.ast).(ast.Decl)
+		shiftOffsets(from, delta, &n.begin, &n.end, &n.innerBegin, &n.innerEnd,
+			&n.paramBegin, &n.paramEnd, &n.resultBegin, &n.resultEnd)
+		nf.functions[k] = n
+	}
+	for k, n := range f.namedTypes {
+		n.tokenFile = tokenFile
+		n.ast = c.node(n.ast).(*ast.TypeSpec)
+		shiftOffsets(from, delta, &n.begin, &n.end)
+		nf.namedTypes[k] = n
+	}
+	for k, n := range f.constants {
+		n.tokenFile = tokenFile
+		n.decl = c.node(n.decl).(*ast.GenDecl)
+		n.spec = c.node(n.spec).(*ast.ValueSpec)
+		shiftOffsets(from, delta, &n.begin, &n.end)
+		nf.constants[k] = n
+	}
+	for k, n := range f.variables {
+		n.tokenFile = tokenFile
+		n.decl = c.node(n.decl).(*ast.GenDecl)
+		n.spec = c.node(n.spec).(*ast.ValueSpec)
+		shiftOffsets(from, delta, &n.begin, &n.end)
+		nf.variables[k] = n
+	}
+	return nf
+}
+
+func shiftOffsets(from, delta int, offsets ...*int) {
+	for _, o := range offsets {
+		if *o >= from {
+			*o += delta
+		}
+	}
+}
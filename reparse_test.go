@@ -0,0 +1,238 @@
+package source
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-services/code"
+	"github.com/stretchr/testify/assert"
+)
+
+const reparseSource = `package source
+
+import (
+	"context"
+	"fmt"
+)
+
+// User is a user.
+type User struct {
+	ID   string ` + "`json:\"id\"`" + `
+	Name string // the name
+}
+
+// Get returns the user.
+func (u *User) Get(ctx context.Context) error {
+	return nil
+}
+
+type Service interface {
+	// Get gets.
+	Get(ctx context.Context) error
+}
+
+const (
+	A = iota
+	B
+)
+
+var v = fmt.Sprint(A) // trailing
+
+func helper(a int) int {
+	return a
+}
+
+type ID string
+
+func (id ID) String() string { return string(id) }
+`
+
+func TestSourceIncrementalReparse(t *testing.T) {
+	incremental, err := New(reparseSource)
+	assert.NoError(t, err)
+	full, err := New(reparseSource, WithFullReparse())
+	assert.NoError(t, err)
+
+	edits := []func(s *Source) error{
+		func(s *Source) error {
+			return s.AppendFieldToStruct("User", code.NewStructField("Age", code.Type{Qualifier: "int"}))
+		},
+		func(s *Source) error {
+			return s.AppendParameterToFunction("helper", code.NewParameter("b", code.Type{Qualifier: "string"}))
+		},
+		func(s *Source) error {
+			return s.AppendMethodToInterface("Service", code.NewInterfaceMethod("List"))
+		},
+		func(s *Source) error { return s.CommentInterface("Service", "Service serves.") },
+		func(s *Source) error { return s.SetFieldTag("User", "Name", "json", "name") },
+		func(s *Source) error { return s.RemoveFieldFromStruct("User", "ID") },
+		func(s *Source) error { return s.RemoveFunction("helper") },
+		func(s *Source) error { return s.RenameStructure("User", "Account") },
+		func(s *Source) error { return s.RemoveParameterFromFunction("Account.Get", "ctx") },
+	}
+	for i, edit := range edits {
+		assert.NoError(t, edit(incremental), i)
+		assert.NoError(t, edit(full), i)
+		assert.Equal(t, full.file.src, incremental.file.src, i)
+		assert.Equal(t, sourceSnapshot(full), sourceSnapshot(incremental), i)
+	}
+	assert.False(t, full.file.incremental)
+	assert.True(t, incremental.file.incremental)
+}
+
+func TestSourceIncrementalReparseCopies(t *testing.T) {
+	src, err := New(reparseSource)
+	assert.NoError(t, err)
+	before := src.file
+	service, err := src.GetInterface("Service")
+	assert.NoError(t, err)
+	pos := service.ast.Pos()
+	tx, err := src.Begin()
+	assert.NoError(t, err)
+
+	assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("Age", code.Type{Qualifier: "int"})))
+	assert.True(t, src.file.incremental)
+	assert.NotEqual(t, before, src.file)
+	assert.Equal(t, reparseSource, before.src)
+	assert.Equal(t, pos, service.ast.Pos())
+	moved, err := src.GetInterface("Service")
+	assert.NoError(t, err)
+	assert.Equal(t, moved.ast, src.file.ast.Decls[3].(*ast.GenDecl).Specs[0])
+	assert.Equal(t, int(moved.ast.Pos())-1, moved.Begin())
+
+	// the transaction was started before the edit
+	assert.NoError(t, tx.AppendMethodToInterface("Service", code.NewInterfaceMethod("List")))
+	assert.Equal(t, ErrTxStale, tx.Commit())
+}
+
+func TestSourceIncrementalReparseResolve(t *testing.T) {
+	src, err := New(`package source
+
+import (
+	"fmt"
+	"strings"
+)
+
+type User struct {
+	Name string
+}
+
+func Print() {
+	fmt.Println("user")
+}
+`)
+	assert.NoError(t, err)
+
+	// the new declaration references a declaration and an import that are not used anywhere else
+	assert.NoError(t, src.AppendParameterToFunction("Print", code.NewParameter("u", code.Type{Qualifier: "User"})))
+	assert.NoError(t, src.AppendParameterToFunction("Print", code.NewParameter("b", code.Type{
+		Import:    &code.Import{Path: "strings"},
+		Qualifier: "Builder",
+	})))
+	assert.True(t, src.file.incremental)
+	assert.Nil(t, src.file.ast.Unresolved)
+
+	assert.NoError(t, src.RemoveUnusedImports())
+	assert.Len(t, src.Imports(), 2)
+
+	assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("Age", code.Type{Qualifier: "int"})))
+	assert.True(t, src.file.incremental)
+	assert.NoError(t, src.RenameStructure("User", "Account"))
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "func Print(u Account, b strings.Builder) {")
+	assert.NotContains(t, out, "User")
+}
+
+// sourceSnapshot describes the nodes and the ast of the source with their positions.
+func sourceSnapshot(s *Source) []string {
+	var lines []string
+	for _, d := range s.Decls() {
+		lines = append(lines, fmt.Sprintf("%s %s %d-%d %s %s %s", d.Kind, d.Node.Name(), d.Node.Begin(), d.Node.End(),
+			d.Node.Position(), d.Node.EndPosition(), d.Node.String()))
+		if n, ok := d.Node.(NodeWithInner); ok {
+			lines = append(lines, fmt.Sprintf("inner %d-%d", n.InnerBegin(), n.InnerEnd()))
+		}
+		switch n := d.Node.(type) {
+		case Structure:
+			for _, f := range n.Fields() {
+				lines = append(lines, fmt.Sprintf("field %s %d-%d %s %v", f.Name(), f.Begin(), f.End(), f.Position(), f.Tags()))
+			}
+			for _, m := range n.Methods() {
+				lines = append(lines, "method "+m.Name())
+			}
+		case Interface:
+			for _, m := range n.Methods() {
+				lines = append(lines, fmt.Sprintf("method %s %d-%d %s %v", m.Name(), m.Begin(), m.End(), m.Position(), m.Annotations()))
+			}
+		case Function:
+			lines = append(lines, fmt.Sprintf("params %d-%d", n.ParamBegin(), n.ParamEnd()))
+		}
+	}
+	for _, i := range s.Imports() {
+		lines = append(lines, fmt.Sprintf("import %s %d-%d %s", i.Import().Path, i.Begin(), i.End(), i.Position()))
+	}
+	ast.Inspect(s.file.ast, func(n ast.Node) bool {
+		if n != nil {
+			lines = append(lines, fmt.Sprintf("%s %d-%d", reflect.TypeOf(n), n.Pos(), n.End()))
+		}
+		return true
+	})
+	var names []string
+	for name := range s.file.ast.Scope.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(lines, strings.Join(names, ","))
+}
+
+// largeSource generates a source with the given number of structures, each with methods
+// and a constructor, 1000 structures are about 20k lines.
+func largeSource(structures int) string {
+	var b strings.Builder
+	b.WriteString("package source\n\nimport (\n\t\"context\"\n\t\"fmt\"\n)\n")
+	for i := 0; i < structures; i++ {
+		fmt.Fprintf(&b, `
+// Model%[1]d is a generated model.
+type Model%[1]d struct {
+	ID    string `+"`json:\"id\"`"+`
+	Name  string `+"`json:\"name\"`"+`
+	Count int
+}
+
+func NewModel%[1]d(id string) *Model%[1]d {
+	return &Model%[1]d{ID: id}
+}
+
+func (m *Model%[1]d) Describe(ctx context.Context) string {
+	return fmt.Sprintf("%%s %%d", m.Name, m.Count)
+}
+`, i)
+	}
+	return b.String()
+}
+
+func benchmarkAppendField(b *testing.B, structures int, opts ...Option) {
+	src, err := New(largeSource(structures), opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		name := fmt.Sprintf("Model%d", i%structures)
+		field := code.NewStructField(fmt.Sprintf("F%d", i), code.Type{Qualifier: "string"})
+		if err := src.AppendFieldToStruct(name, field); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendFieldIncremental250(b *testing.B) { benchmarkAppendField(b, 250) }
+func BenchmarkAppendFieldFull250(b *testing.B)        { benchmarkAppendField(b, 250, WithFullReparse()) }
+
+func BenchmarkAppendFieldIncremental1000(b *testing.B) { benchmarkAppendField(b, 1000) }
+func BenchmarkAppendFieldFull1000(b *testing.B)        { benchmarkAppendField(b, 1000, WithFullReparse()) }
@@ -5,8 +5,13 @@ import (
 	"go/ast"
 	"go/format"
 	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/go-errors/errors"
 	"github.com/go-services/code"
 )
 
@@ -14,24 +19,128 @@ type Source struct {
 	file          *file
 	parser        *fileParser
 	parserOptions *Options
+
+	// the path of the file the source was opened from, empty if the source was not opened from disk
+	path string
+
+	// the content of the file when it was opened or last saved
+	// this is used to detect if the file was changed by someone else
+	disk string
+
+	// the text the source was parsed from or last saved, used to show the pending changes
+	original string
+
+	// true if the source was loaded from the fs.FS of the build context, the path is not a path on disk
+	readOnly bool
+
+	// the transaction the edits are recorded in, nil if edits are applied immediately
+	tx *Tx
 }
 
 func New(src string, opts ...Option) (*Source, error) {
-	p := newParser(opts...)
+	return newSource(newParser(opts...), src)
+}
+
+func newSource(p *fileParser, src string) (*Source, error) {
 	f, err := p.parse(src)
 	if err != nil {
 		return nil, err
 	}
 	return &Source{
-		file:   f,
-		parser: p,
+		file:     f,
+		parser:   p,
+		original: src,
 	}, nil
 }
 
+// Open parses the file at the given path, the source remembers the path so it can be saved using Save.
+func Open(path string, opts ...Option) (*Source, error) {
+	return openFile(fileSystem{}, path, opts...)
+}
+
+func openFile(fsys fileSystem, path string, opts ...Option) (*Source, error) {
+	data, err := fsys.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(opts...)
+	p.filename = path
+	s, err := newSource(p, string(data))
+	if err != nil {
+		return nil, err
+	}
+	s.path = path
+	s.disk = string(data)
+	s.readOnly = fsys.fs != nil
+	return s, nil
+}
+
+// Path returns the path of the file the source was opened from or saved to.
+func (s *Source) Path() string {
+	return s.path
+}
+
+// Modified returns true if the source was changed since it was opened or last saved.
+func (s *Source) Modified() bool {
+	return s.file.src != s.disk
+}
+
+// Save writes the source to the file it was opened from, if the file was changed on disk
+// since it was opened a ConflictError is returned instead.
+// Sources loaded from the fs.FS of the build context return a ReadOnlyError.
+func (s *Source) Save() error {
+	if s.path == "" {
+		return errors.New("source was not opened from a file, use SaveAs")
+	}
+	if s.readOnly {
+		return &ReadOnlyError{Path: s.path}
+	}
+	current, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if string(current) != s.disk {
+		return &ConflictError{Path: s.path}
+	}
+	return s.SaveAs(s.path)
+}
+
+// SaveAs writes the formatted source to the given path and remembers it for later calls to Save.
+// The file is written atomically and keeps the permissions of the file it replaces.
+func (s *Source) SaveAs(path string) error {
+	out, err := s.String()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(out)); err != nil {
+		return err
+	}
+	s.path = path
+	s.disk = out
+	s.original = out
+	s.readOnly = false
+	if s.parser.filename != path {
+		// positions use the new file name
+		s.parser.filename = path
+		s.file.src = out
+		return s.parseAgain("SaveAs")
+	}
+	if s.file.src == out {
+		return nil
+	}
+	s.file.src = out
+	return s.parseAgain("SaveAs")
+}
+
 func (s *Source) Package() string {
 	return s.file.pkg
 }
 
+// ImportCache returns the cache used to resolve the imports of the source.
+func (s *Source) ImportCache() *ImportCache {
+	return s.parser.importCache
+}
+
 func (s *Source) Imports() []Import {
 	return s.file.imports
 }
@@ -42,7 +151,7 @@ func (s *Source) AppendFieldToStruct(name string, field *code.StructField) error
 		return err
 	}
 	s.file.src = appendCodeToInner(s.file.src, structure, field)
-	return s.parseAgain()
+	return s.parseAgain("AppendFieldToStruct")
 }
 
 func (s *Source) AppendMethodToInterface(name string, method code.InterfaceMethod) error {
@@ -51,10 +160,36 @@ func (s *Source) AppendMethodToInterface(name string, method code.InterfaceMetho
 		return err
 	}
 	s.file.src = appendCodeToInner(s.file.src, inf, &method)
-	return s.parseAgain()
+	return s.parseAgain("AppendMethodToInterface")
 }
 
-func (s *Source) AppendImport(imp code.Import) error {
+// AppendImport adds the import and returns the name the package is referenced with in the file,
+// if the path is already imported the name of the existing import is returned.
+// An alias is picked when the package name conflicts with another import or a top level
+// declaration e.x `errors2`.
+func (s *Source) AppendImport(imp code.Import) (string, error) {
+	for _, i := range s.file.imports {
+		if i.code.Path != imp.Path {
+			continue
+		}
+		// blank and dot imports do not make the package name available
+		if i.Name() == imp.Alias || (i.Name() != "_" && i.Name() != ".") {
+			return i.Name(), nil
+		}
+	}
+	name := imp.Alias
+	if name != "_" && name != "." {
+		pkg := s.packageName(imp.Path)
+		if name == "" {
+			name = pkg
+		}
+		name = s.freeName(name)
+		imp.Alias = ""
+		if name != pkg {
+			imp.Alias = name
+		}
+	}
+	spec := importSpec(imp.Alias, imp.Path)
 	var importDecl *ast.GenDecl
 	for _, v := range s.file.ast.Decls {
 		if dec, ok := v.(*ast.GenDecl); ok && dec.Tok == token.IMPORT {
@@ -62,29 +197,46 @@ func (s *Source) AppendImport(imp code.Import) error {
 		}
 	}
 	if importDecl == nil {
-		pre := strings.TrimRight(s.file.src[:s.file.ast.Name.End()-1], "\n") + "\n"
-		mid := fmt.Sprintf(`import %s "%s"`, imp.Alias, imp.Path)
+		pre := strings.TrimRight(s.file.src[:s.file.ast.Name.End()-1], "\n") + "\n\n"
+		mid := "import " + spec
 		end := s.file.src[s.file.ast.Name.End()-1:]
 		s.file.src = fmt.Sprintf("%s%s%s", pre, mid, end)
-		return s.parseAgain()
+		return name, s.parseAgain("AppendImport")
 	}
 	if importDecl.Lparen == token.NoPos {
-		pos := int(importDecl.TokPos) + len(importDecl.Tok.String())
-		pre := s.file.src[:pos] + "(\n"
-		mid := ""
-		end := ")\n" + s.file.src[importDecl.End():]
-		for _, i := range s.file.imports {
-			mid += "\t" + fmt.Sprintf(`%s "%s"`, i.code.Alias, i.code.Path) + "\n"
-		}
-		mid += "\t" + fmt.Sprintf(`%s "%s"`, imp.Alias, imp.Path) + "\n"
-		s.file.src = fmt.Sprintf("%s%s%s", pre, mid, end)
-		return s.parseAgain()
+		// keep the existing specification as it is written e.x with its comment
+		existing := importDecl.Specs[0].(*ast.ImportSpec)
+		begin, end := int(existing.Pos())-1, int(existing.End())-1
+		if existing.Comment != nil {
+			end = int(existing.Comment.End()) - 1
+		}
+		s.file.src = s.file.src[:begin] + "(\n\t" + s.file.src[begin:end] + "\n\t" + spec + "\n)" + s.file.src[end:]
+		return name, s.parseAgain("AppendImport")
 	}
 	pre := s.file.src[:importDecl.End()-2]
-	mid := "\t" + fmt.Sprintf(`%s "%s"`, imp.Alias, imp.Path) + "\n"
+	mid := "\t" + spec + "\n"
 	end := s.file.src[importDecl.End()-2:]
 	s.file.src = fmt.Sprintf("%s%s%s", pre, mid, end)
-	return s.parseAgain()
+	return name, s.parseAgain("AppendImport")
+}
+
+// packageName returns the name of the package with the given import path.
+func (s *Source) packageName(path string) string {
+	if pkg, err := s.parser.importPackage(path); err == nil && pkg.Name != "" {
+		return pkg.Name
+	}
+	return defaultImportName(path)
+}
+
+// freeName returns the name or the name with a number suffix if it conflicts with
+// another import or an identifier of the file e.x a top level declaration, a parameter or a local variable.
+func (s *Source) freeName(name string) string {
+	used := s.identNames()
+	free := name
+	for i := 2; used[free]; i++ {
+		free = name + strconv.Itoa(i)
+	}
+	return free
 }
 
 func (s *Source) AppendParameterToFunction(name string, param *code.Parameter) error {
@@ -93,13 +245,14 @@ func (s *Source) AppendParameterToFunction(name string, param *code.Parameter) e
 		return err
 	}
 	pre := s.file.src[:fn.ParamEnd()]
-	if len(fn.code.Params) > 0 {
+	// parameter lists that span multiple lines can end with a comma
+	if fn.ast.(*ast.FuncDecl).Type.Params.NumFields() > 0 && !strings.HasSuffix(strings.TrimSpace(pre), ",") {
 		pre += ", "
 	}
 	mid := param.String()
 	end := s.file.src[fn.ParamEnd():]
 	s.file.src = fmt.Sprintf("%s%s%s", pre, mid, end)
-	return s.parseAgain()
+	return s.parseAgain("AppendParameterToFunction")
 }
 
 func (s *Source) AppendCodeToFunction(name string, method *code.RawCode) error {
@@ -108,36 +261,379 @@ func (s *Source) AppendCodeToFunction(name string, method *code.RawCode) error {
 		return err
 	}
 	s.file.src = appendCodeToInner(s.file.src, fn, method)
-	return s.parseAgain()
+	return s.parseAgain("AppendCodeToFunction")
 }
 
 func (s *Source) AppendStructure(structure code.Struct) error {
 	s.file.src += "\n" + structure.String()
-	return s.parseAgain()
+	return s.parseAgain("AppendStructure")
 }
 
 func (s *Source) AppendInterface(inf code.Interface) error {
 	s.file.src += "\n" + inf.String()
-	return s.parseAgain()
+	return s.parseAgain("AppendInterface")
 }
 
 func (s *Source) AppendFunction(fn code.Function) error {
 	s.file.src += "\n" + fn.String()
-	return s.parseAgain()
+	return s.parseAgain("AppendFunction")
+}
+
+func (s *Source) AppendConstant(name string, tp *code.Type, value string) error {
+	s.file.src += "\nconst " + valueSpecCode(name, tp, value) + "\n"
+	return s.parseAgain("AppendConstant")
+}
+
+func (s *Source) AppendVariable(name string, tp *code.Type, value string) error {
+	s.file.src += "\nvar " + valueSpecCode(name, tp, value) + "\n"
+	return s.parseAgain("AppendVariable")
+}
+
+// AppendConstantToGroup adds a constant to the `const (...)` block that declares the constant `member`,
+// if value is empty the constant repeats the previous expression, this is how values are added to `iota` enums.
+func (s *Source) AppendConstantToGroup(member, name string, tp *code.Type, value string) error {
+	c, err := s.GetConstant(member)
+	if err != nil {
+		return err
+	}
+	s.file.src = appendSpecToGroup(s.file.src, c.decl, valueSpecCode(name, tp, value))
+	return s.parseAgain("AppendConstantToGroup")
+}
+
+// AppendVariableToGroup adds a variable to the `var (...)` block that declares the variable `member`.
+func (s *Source) AppendVariableToGroup(member, name string, tp *code.Type, value string) error {
+	v, err := s.GetVariable(member)
+	if err != nil {
+		return err
+	}
+	s.file.src = appendSpecToGroup(s.file.src, v.decl, valueSpecCode(name, tp, value))
+	return s.parseAgain("AppendVariableToGroup")
 }
 
-func (s *Source) parseAgain() error {
-	f, err := s.parser.parse(s.file.src)
+// RemoveConstant removes the constant together with its comments, a constant of an iota enum
+// that is followed by other constants is replaced with `_` so their values do not change.
+func (s *Source) RemoveConstant(name string) error {
+	c, err := s.GetConstant(name)
 	if err != nil {
 		return err
 	}
+	if len(c.spec.Names) > 1 {
+		return &UnsupportedError{Op: "RemoveConstant", Name: name, Reason: "the constant is declared together with other constants"}
+	}
+	src := s.file.src
+	idx := specIndex(c.decl, c.spec)
+	if c.enum && idx+1 < len(c.decl.Specs) {
+		// the values of the following constants depend on their position,
+		// so the constant is replaced with `_` to keep them e.x `_ Status = iota`
+		if c.spec.Comment != nil {
+			src = removeCode(src, int(c.spec.Comment.Pos())-1, int(c.spec.Comment.End())-1)
+		}
+		id := c.spec.Names[0]
+		src = src[:id.Pos()-1] + "_" + src[id.End()-1:]
+		if c.spec.Doc != nil {
+			src = removeCode(src, int(c.spec.Doc.Pos())-1, int(c.spec.Doc.End())-1)
+		}
+		s.file.src = src
+		return s.parseAgain("RemoveConstant")
+	}
+	if len(c.spec.Values) > 0 && idx+1 < len(c.decl.Specs) {
+		// the next constant repeats the expression of the removed one, so it needs to be moved
+		next := c.decl.Specs[idx+1].(*ast.ValueSpec)
+		if len(next.Values) == 0 {
+			pos := int(next.Names[len(next.Names)-1].End()) - 1
+			mid := ""
+			if c.spec.Type != nil {
+				mid += " " + src[c.spec.Type.Pos()-1:c.spec.Type.End()-1]
+			}
+			mid += " = " + src[c.spec.Values[0].Pos()-1:c.spec.Values[len(c.spec.Values)-1].End()-1]
+			src = src[:pos] + mid + src[pos:]
+		}
+	}
+	s.file.src = removeSpec(src, c.decl, c.spec)
+	return s.parseAgain("RemoveConstant")
+}
+
+func (s *Source) RemoveVariable(name string) error {
+	v, err := s.GetVariable(name)
+	if err != nil {
+		return err
+	}
+	if len(v.spec.Names) > 1 {
+		return &UnsupportedError{Op: "RemoveVariable", Name: name, Reason: "the variable is declared together with other variables"}
+	}
+	s.file.src = removeSpec(s.file.src, v.decl, v.spec)
+	return s.parseAgain("RemoveVariable")
+}
+
+// RemoveStructure removes the structure together with its doc comments.
+func (s *Source) RemoveStructure(name string) error {
+	structure, err := s.GetStructure(name)
+	if err != nil {
+		return err
+	}
+	s.file.src = removeSpec(s.file.src, s.file.declOf(structure.ast), structure.ast)
+	return s.parseAgain("RemoveStructure")
+}
+
+// RemoveInterface removes the interface together with its doc comments.
+func (s *Source) RemoveInterface(name string) error {
+	inf, err := s.GetInterface(name)
+	if err != nil {
+		return err
+	}
+	s.file.src = removeSpec(s.file.src, s.file.declOf(inf.ast), inf.ast)
+	return s.parseAgain("RemoveInterface")
+}
+
+// RemoveFunction removes the function together with its doc comments.
+func (s *Source) RemoveFunction(name string) error {
+	fn, err := s.GetFunction(name)
+	if err != nil {
+		return err
+	}
+	decl := fn.ast.(*ast.FuncDecl)
+	begin := decl.Pos()
+	if decl.Doc != nil {
+		begin = decl.Doc.Pos()
+	}
+	s.file.src = removeCode(s.file.src, int(begin)-1, fn.End())
+	return s.parseAgain("RemoveFunction")
+}
+
+func (s *Source) RemoveFieldFromStruct(name, field string) error {
+	structure, err := s.GetStructure(name)
+	if err != nil {
+		return err
+	}
+	for _, f := range structure.Fields() {
+		if f.Name() != field {
+			continue
+		}
+		if len(f.ast.Names) > 1 {
+			s.file.src = removeListItem(s.file.src, identNodes(f.ast.Names), nameIndex(f.ast.Names, field))
+		} else {
+			s.file.src = removeField(s.file.src, f.ast)
+		}
+		return s.parseAgain("RemoveFieldFromStruct")
+	}
+	return &NotFoundError{Kind: "field", Name: field, ParentKind: "structure", Parent: name}
+}
+
+func (s *Source) RemoveMethodFromInterface(name, method string) error {
+	inf, err := s.GetInterface(name)
+	if err != nil {
+		return err
+	}
+	for _, m := range inf.Methods() {
+		if m.Name() != method {
+			continue
+		}
+		if len(m.ast.Names) > 1 {
+			s.file.src = removeListItem(s.file.src, identNodes(m.ast.Names), nameIndex(m.ast.Names, method))
+		} else {
+			s.file.src = removeField(s.file.src, m.ast)
+		}
+		return s.parseAgain("RemoveMethodFromInterface")
+	}
+	return &NotFoundError{Kind: "method", Name: method, ParentKind: "interface", Parent: name}
+}
+
+// RemoveImport removes the import with the given path, if it is the only import
+// in the declaration the whole declaration is removed.
+func (s *Source) RemoveImport(path string) error {
+	for _, i := range s.file.imports {
+		if i.code.Path == path {
+			return s.removeImport(i, "RemoveImport")
+		}
+	}
+	return &NotFoundError{Kind: "import", Name: path}
+}
+
+// RemoveUnusedImports removes the imports whose package is not referenced in the file,
+// blank and dot imports are kept. Imports without an alias whose package can not be found by the
+// build context are kept as well, their package name is only guessed from the import path.
+func (s *Source) RemoveUnusedImports() error {
+	if err := s.resolve(); err != nil {
+		return err
+	}
+	used := usedPackageNames(s.file.ast)
+	unused := map[ast.Spec]bool{}
+	for _, i := range s.file.imports {
+		if i.code.Alias == "" && i.code.FilePath == "" {
+			continue
+		}
+		if name := i.Name(); name != "_" && name != "." && !used[name] {
+			unused[i.ast] = true
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	// the imports are removed in a single edit starting from the end so the positions stay valid
+	for i := len(s.file.ast.Decls) - 1; i >= 0; i-- {
+		dec, ok := s.file.ast.Decls[i].(*ast.GenDecl)
+		if !ok || dec.Tok != token.IMPORT {
+			continue
+		}
+		var specs []ast.Spec
+		for _, spec := range dec.Specs {
+			if unused[spec] {
+				specs = append(specs, spec)
+			}
+		}
+		if len(specs) > 0 {
+			s.file.src = removeSpecs(s.file.src, dec, specs)
+		}
+	}
+	return s.parseAgain("RemoveUnusedImports")
+}
+
+func (s *Source) removeImport(imp Import, op string) error {
+	for _, d := range s.file.ast.Decls {
+		dec, ok := d.(*ast.GenDecl)
+		if !ok || dec.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range dec.Specs {
+			if spec == imp.ast {
+				s.file.src = removeSpec(s.file.src, dec, spec)
+				return s.parseAgain(op)
+			}
+		}
+	}
+	return &NotFoundError{Kind: "import", Name: imp.code.Path}
+}
+
+func (s *Source) RemoveParameterFromFunction(name, param string) error {
+	fn, err := s.GetFunction(name)
+	if err != nil {
+		return err
+	}
+	params := fn.ast.(*ast.FuncDecl).Type.Params.List
+	for i, p := range params {
+		idx := nameIndex(p.Names, param)
+		if idx < 0 {
+			continue
+		}
+		if len(p.Names) > 1 {
+			s.file.src = removeListItem(s.file.src, identNodes(p.Names), idx)
+		} else {
+			s.file.src = removeListItem(s.file.src, fieldNodes(params), i)
+		}
+		return s.parseAgain("RemoveParameterFromFunction")
+	}
+	return &NotFoundError{Kind: "parameter", Name: param, ParentKind: "function", Parent: name}
+}
+
+// ReplaceStructure replaces the structure, including its doc comments, with the given structure.
+func (s *Source) ReplaceStructure(name string, structure code.Struct) error {
+	st, err := s.GetStructure(name)
+	if err != nil {
+		return err
+	}
+	s.file.src = replaceSpec(s.file.src, s.file.declOf(st.ast), st.ast, structure.String())
+	return s.parseAgain("ReplaceStructure")
+}
+
+// ReplaceInterface replaces the interface, including its doc comments, with the given interface.
+func (s *Source) ReplaceInterface(name string, inf code.Interface) error {
+	ifc, err := s.GetInterface(name)
+	if err != nil {
+		return err
+	}
+	s.file.src = replaceSpec(s.file.src, s.file.declOf(ifc.ast), ifc.ast, inf.String())
+	return s.parseAgain("ReplaceInterface")
+}
+
+// ReplaceFunction replaces the function, including its doc comments, with the given function.
+func (s *Source) ReplaceFunction(name string, fn code.Function) error {
+	f, err := s.GetFunction(name)
+	if err != nil {
+		return err
+	}
+	decl := f.ast.(*ast.FuncDecl)
+	begin := decl.Pos()
+	if decl.Doc != nil {
+		begin = decl.Doc.Pos()
+	}
+	pre := s.file.src[:begin-1]
+	mid := fn.String()
+	end := s.file.src[f.End():]
+	s.file.src = fmt.Sprintf("%s%s%s", pre, mid, end)
+	return s.parseAgain("ReplaceFunction")
+}
+
+// parseAgain parses the source after the edit operation op changed it,
+// if the edit produced invalid code the source is restored.
+// Inside a transaction the edit is recorded instead and the source is parsed once on commit.
+func (s *Source) parseAgain(op string) error {
+	if s.tx != nil {
+		s.tx.record(op, s.file.parsedSrc, s.file.src)
+		s.file.src = s.file.parsedSrc
+		return nil
+	}
+	f, ok := s.parser.reparse(s.file, s.file.src)
+	if !ok {
+		var err error
+		if f, err = s.parser.parse(s.file.src); err != nil {
+			s.file.src = s.file.parsedSrc
+			return &EditError{Op: op, Err: err}
+		}
+	}
+	// the previous file stays as it was parsed, nodes and transactions may still use it
+	s.file.src = s.file.parsedSrc
 	s.file = f
 	return nil
 }
 
+// FindByAnnotation returns every node, in declaration order, that has an annotation or directive
+// with the given name e.x `http` for `// @http method=GET` or `go:generate`.
+// Structure fields and interface methods are returned after the declaration that contains them.
+func (s *Source) FindByAnnotation(name string) (nodes []Node) {
+	for _, d := range s.Decls() {
+		if hasAnnotation(d.Node.Annotations(), name) {
+			nodes = append(nodes, d.Node)
+		}
+		switch n := d.Node.(type) {
+		case Structure:
+			for _, f := range n.Fields() {
+				if hasAnnotation(f.Annotations(), name) {
+					nodes = append(nodes, f)
+				}
+			}
+		case Interface:
+			for _, m := range n.Methods() {
+				if hasAnnotation(m.Annotations(), name) {
+					nodes = append(nodes, m)
+				}
+			}
+		}
+	}
+	return
+}
+
+// Diagnostics returns the constructs that were skipped while parsing the source
+// e.x malformed struct tags, invalid declarations or duplicate declarations.
+func (s *Source) Diagnostics() []Diagnostic {
+	return s.file.diagnostics
+}
+
+// Decls returns every top level declaration in the order it is declared in the source.
+func (s *Source) Decls() (decls []Decl) {
+	for _, ref := range s.file.order {
+		decls = append(decls, Decl{
+			Kind: ref.kind,
+			Node: s.file.node(ref),
+		})
+	}
+	return
+}
+
 func (s *Source) Structures() (structures []Structure) {
-	for _, v := range s.file.structures {
-		structures = append(structures, v)
+	for _, ref := range s.file.order {
+		if ref.kind == StructureDecl {
+			structures = append(structures, s.file.structures[ref.key])
+		}
 	}
 	return
 }
@@ -146,7 +642,7 @@ func (s *Source) GetStructure(name string) (*Structure, error) {
 	if v, ok := s.file.structures[name]; ok {
 		return &v, nil
 	} else {
-		return nil, fmt.Errorf("no structure with name `%s` found", name)
+		return nil, &NotFoundError{Kind: "structure", Name: name}
 	}
 }
 
@@ -154,32 +650,147 @@ func (s *Source) GetInterface(name string) (*Interface, error) {
 	if v, ok := s.file.interfaces[name]; ok {
 		return &v, nil
 	} else {
-		return nil, fmt.Errorf("no interface with name `%s` found", name)
+		return nil, &NotFoundError{Kind: "interface", Name: name}
 	}
 }
 
+// GetFunction returns the function with the given name, methods can be targeted using
+// the receiver type as prefix e.x `Repo.Get`. A method can also be found by its name alone
+// as long as no other function or method has the same name.
 func (s *Source) GetFunction(name string) (*Function, error) {
 	if v, ok := s.file.functions[name]; ok {
 		return &v, nil
+	}
+	var found []Function
+	for _, v := range s.file.functions {
+		if v.Name() == name {
+			found = append(found, v)
+		}
+	}
+	if len(found) > 1 {
+		// the receiver type selects the method e.x `User.Get`
+		matches := make([]string, len(found))
+		for i, fn := range found {
+			matches[i] = fn.ReceiverType() + "." + fn.Name()
+		}
+		sort.Strings(matches)
+		return nil, &AmbiguousError{Kind: "function", Name: name, Matches: matches}
+	} else if len(found) == 0 {
+		return nil, &NotFoundError{Kind: "function", Name: name}
+	}
+	return &found[0], nil
+}
+
+// GetMethod returns the method with the given name declared on the receiver type,
+// the receiver type can be given with or without pointer e.x `*Repo` or `Repo`.
+func (s *Source) GetMethod(receiverType, name string) (*Function, error) {
+	receiverType = strings.TrimPrefix(receiverType, "*")
+	if v, ok := s.file.functions[functionKey(receiverType, name)]; ok {
+		return &v, nil
+	} else {
+		return nil, &NotFoundError{Kind: "method", Name: name, ParentKind: "type", Parent: receiverType}
+	}
+}
+
+func (s *Source) GetNamedType(name string) (*NamedType, error) {
+	if v, ok := s.file.namedTypes[name]; ok {
+		return &v, nil
+	} else {
+		return nil, &NotFoundError{Kind: "named type", Name: name}
+	}
+}
+
+func (s *Source) NamedTypes() (namedTypes []NamedType) {
+	for _, ref := range s.file.order {
+		if ref.kind == NamedTypeDecl {
+			namedTypes = append(namedTypes, s.file.namedTypes[ref.key])
+		}
+	}
+	return
+}
+
+func (s *Source) GetConstant(name string) (*Constant, error) {
+	if v, ok := s.file.constants[name]; ok {
+		return &v, nil
 	} else {
-		return nil, fmt.Errorf("no function with name `%s` found", name)
+		return nil, &NotFoundError{Kind: "constant", Name: name}
+	}
+}
+
+func (s *Source) GetVariable(name string) (*Variable, error) {
+	if v, ok := s.file.variables[name]; ok {
+		return &v, nil
+	} else {
+		return nil, &NotFoundError{Kind: "variable", Name: name}
+	}
+}
+
+func (s *Source) Constants() (constants []Constant) {
+	for _, ref := range s.file.order {
+		if ref.kind == ConstantDecl {
+			constants = append(constants, s.file.constants[ref.key])
+		}
 	}
+	return
+}
+
+func (s *Source) Variables() (variables []Variable) {
+	for _, ref := range s.file.order {
+		if ref.kind == VariableDecl {
+			variables = append(variables, s.file.variables[ref.key])
+		}
+	}
+	return
 }
 
 func (s *Source) Interfaces() (interfaces []Interface) {
-	for _, v := range s.file.interfaces {
-		interfaces = append(interfaces, v)
+	for _, ref := range s.file.order {
+		if ref.kind == InterfaceDecl {
+			interfaces = append(interfaces, s.file.interfaces[ref.key])
+		}
 	}
 	return
 }
 
 func (s *Source) Functions() (functions []Function) {
-	for _, v := range s.file.functions {
-		functions = append(functions, v)
+	for _, ref := range s.file.order {
+		if ref.kind == FunctionDecl {
+			functions = append(functions, s.file.functions[ref.key])
+		}
 	}
 	return
 }
 
+// MethodSet returns every method of the interface including the methods of the interfaces it embeds,
+// only embedded interfaces declared in this file and `error` are resolved.
+// If an embedded interface can not be resolved the resolved methods are returned
+// together with an UnresolvedEmbedsError.
+func (s *Source) MethodSet(name string) ([]InterfaceMethod, error) {
+	inf, err := s.GetInterface(name)
+	if err != nil {
+		return nil, err
+	}
+	return resolvedMethodSet(inf, s.GetInterface)
+}
+
+// lookup returns the top level declaration with the given name, nil if there is none.
+func (s *Source) lookup(name string) Node {
+	if v, ok := s.file.structures[name]; ok {
+		return v
+	} else if v, ok := s.file.interfaces[name]; ok {
+		return v
+	} else if v, ok := s.file.namedTypes[name]; ok {
+		return v
+	} else if v, ok := s.file.constants[name]; ok {
+		return v
+	} else if v, ok := s.file.variables[name]; ok {
+		return v
+	} else if v, err := s.GetFunction(name); err == nil {
+		return *v
+	}
+	return nil
+}
+
 func (s *Source) CommentInterfaceMethod(inf, method string, comment string) error {
 	ifc, err := s.GetInterface(inf)
 	if err != nil {
@@ -187,10 +798,10 @@ func (s *Source) CommentInterfaceMethod(inf, method string, comment string) erro
 	}
 	for _, m := range ifc.Methods() {
 		if m.Name() == method {
-			return s.comment(&m, comment)
+			return s.comment("CommentInterfaceMethod", &m, comment)
 		}
 	}
-	return fmt.Errorf("method with name `%s` not found in interface `%s`", method, inf)
+	return &NotFoundError{Kind: "method", Name: method, ParentKind: "interface", Parent: inf}
 }
 
 func (s *Source) CommentInterface(inf, comment string) error {
@@ -198,10 +809,10 @@ func (s *Source) CommentInterface(inf, comment string) error {
 	if err != nil {
 		return err
 	}
-	return s.comment(ifc, comment)
+	return s.comment("CommentInterface", ifc, comment)
 }
 
-func (s *Source) comment(node Node, comment string) error {
+func (s *Source) comment(op string, node Node, comment string) error {
 	pre := s.file.src[:node.Begin()]
 	mid := code.Comment(comment).String() + "\n"
 	end := s.file.src[node.Begin():]
@@ -211,15 +822,19 @@ func (s *Source) comment(node Node, comment string) error {
 		mid,
 		end,
 	)
-	f, err := s.parser.parse(s.file.src)
-	if err != nil {
-		return err
-	}
-	s.file = f
-	return nil
+	return s.parseAgain(op)
 }
 
+// String returns the formatted source, the imports are organized when using WithOrganizeImports.
+// When using WithMinimalEdits only the declarations changed since the source was parsed are formatted.
 func (s *Source) String() (string, error) {
-	src, err := format.Source([]byte(s.file.src))
-	return string(src), err
+	src := s.file.src
+	if s.parser.organizeImports != nil && src == s.file.parsedSrc {
+		src = organizeImports(src, s.file.ast, s.localPrefixes(*s.parser.organizeImports))
+	}
+	if s.parser.minimalEdits {
+		return formatChanges(s.original, src)
+	}
+	out, err := format.Source([]byte(src))
+	return string(out), err
 }
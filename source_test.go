@@ -1,8 +1,14 @@
 package source
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/dave/jennifer/jen"
+	"github.com/go-services/code"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,3 +36,863 @@ func TestNewSource(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, src)
 }
+
+func TestSourceConstantsAndVariables(t *testing.T) {
+	src, err := New(`
+package source
+
+import "errors"
+
+// Status is the status of an order
+type Status int
+
+const (
+	// StatusPending is the default status
+	StatusPending Status = iota
+	StatusPaid
+	StatusShipped
+)
+
+const MaxRetries = 3
+
+var ErrNotFound = errors.New("not found")
+
+var (
+	defaultTimeout = 10
+	a, b           = 1, 2
+)
+`)
+	assert.NoError(t, err)
+	assert.Len(t, src.Constants(), 4)
+	assert.Len(t, src.Variables(), 4)
+
+	paid, err := src.GetConstant("StatusPaid")
+	assert.NoError(t, err)
+	assert.True(t, paid.Enum())
+	assert.True(t, paid.Grouped())
+	assert.Equal(t, 1, paid.Iota())
+	assert.Equal(t, "iota", paid.Value())
+	assert.Equal(t, "Status", paid.Type().Qualifier)
+
+	b, err := src.GetVariable("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", b.Value())
+
+	assert.NoError(t, src.AppendConstantToGroup("StatusPending", "StatusDelivered", nil, ""))
+	delivered, err := src.GetConstant("StatusDelivered")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, delivered.Iota())
+
+	// the values of the other members of the enum do not change
+	assert.NoError(t, src.RemoveConstant("StatusPending"))
+	paid, err = src.GetConstant("StatusPaid")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, paid.Iota())
+	assert.Equal(t, "iota", paid.Value())
+	assert.NoError(t, src.RemoveConstant("StatusDelivered"))
+
+	assert.NoError(t, src.AppendConstantToGroup("MaxRetries", "MinRetries", nil, "1"))
+	assert.NoError(t, src.RemoveVariable("ErrNotFound"))
+	assert.NoError(t, src.AppendVariable("ErrConflict", nil, `errors.New("conflict")`))
+
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, `package source
+
+import "errors"
+
+// Status is the status of an order
+type Status int
+
+const (
+	_ Status = iota
+	StatusPaid
+	StatusShipped
+)
+
+const (
+	MaxRetries = 3
+	MinRetries = 1
+)
+
+var (
+	defaultTimeout = 10
+	a, b           = 1, 2
+)
+
+var ErrConflict = errors.New("conflict")
+`, out)
+	_, err = src.GetConstant("StatusPending")
+	assert.Error(t, err)
+}
+
+func TestSourceMethods(t *testing.T) {
+	src, err := New(`
+package source
+
+type A struct{}
+
+type B struct{}
+
+type Status int
+
+func (a *A) Close() error {
+	return nil
+}
+
+func (b B) Close() error {
+	return nil
+}
+
+func (s Status) String() string {
+	return ""
+}
+
+func New() *A {
+	return &A{}
+}
+`)
+	assert.NoError(t, err)
+	assert.Len(t, src.Functions(), 4)
+
+	a, err := src.GetStructure("A")
+	assert.NoError(t, err)
+	assert.Len(t, a.Methods(), 1)
+	assert.Equal(t, "A", a.Methods()[0].ReceiverType())
+
+	status, err := src.GetNamedType("Status")
+	assert.NoError(t, err)
+	assert.Len(t, status.Methods(), 1)
+
+	closeB, err := src.GetMethod("B", "Close")
+	assert.NoError(t, err)
+	assert.Equal(t, "B.Close", closeB.Key())
+
+	_, err = src.GetMethod("*A", "Close")
+	assert.NoError(t, err)
+	_, err = src.GetFunction("Close")
+	assert.Error(t, err)
+	_, err = src.GetFunction("String")
+	assert.NoError(t, err)
+
+	assert.NoError(t, src.AppendCodeToFunction("A.Close", code.NewRawCode(jen.Id("a").Op("=").Nil())))
+	closeA, err := src.GetMethod("A", "Close")
+	assert.NoError(t, err)
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Contains(t, out[closeA.InnerBegin():closeA.InnerEnd()], "a = nil")
+}
+
+func TestSourceOpenAndSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pth := filepath.Join(dir, "user.go")
+	assert.NoError(t, ioutil.WriteFile(pth, []byte("package users\n\ntype User struct{}\n"), 0600))
+
+	src, err := Open(pth)
+	assert.NoError(t, err)
+	assert.Equal(t, pth, src.Path())
+	assert.False(t, src.Modified())
+
+	assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("ID", code.Type{Qualifier: "string"})))
+	assert.True(t, src.Modified())
+	assert.NoError(t, src.Save())
+	assert.False(t, src.Modified())
+
+	info, err := os.Stat(pth)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := ioutil.ReadFile(pth)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ID string")
+
+	// someone else changes the file
+	assert.NoError(t, ioutil.WriteFile(pth, []byte("package users\n"), 0600))
+	assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("Name", code.Type{Qualifier: "string"})))
+	err = src.Save()
+	assert.IsType(t, &ConflictError{}, err)
+
+	assert.NoError(t, src.SaveAs(filepath.Join(dir, "copy.go")))
+	assert.Equal(t, filepath.Join(dir, "copy.go"), src.Path())
+}
+
+func TestSourceRemove(t *testing.T) {
+	src, err := New(`package source
+
+import (
+	"context"
+	"errors"
+)
+
+// User is a user
+type User struct {
+	// ID is the user id
+	ID         string
+	First, Last string
+	Age        int // age in years
+}
+
+// Service does things
+type Service interface {
+	// Get returns a user
+	Get(ctx context.Context, id string) (User, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type (
+	A struct{}
+	B struct{}
+)
+
+// Get returns a user
+func Get(ctx context.Context, id string, force bool) (User, error) {
+	return User{}, errors.New("not implemented")
+}
+
+func Delete() {}
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, src.RemoveFieldFromStruct("User", "ID"))
+	assert.NoError(t, src.RemoveFieldFromStruct("User", "Last"))
+	assert.NoError(t, src.RemoveFieldFromStruct("User", "Age"))
+	assert.NoError(t, src.RemoveMethodFromInterface("Service", "Get"))
+	assert.NoError(t, src.RemoveParameterFromFunction("Get", "id"))
+	assert.NoError(t, src.RemoveParameterFromFunction("Get", "force"))
+	assert.NoError(t, src.RemoveStructure("A"))
+	assert.NoError(t, src.RemoveFunction("Delete"))
+	assert.Error(t, src.RemoveFunction("Delete"))
+
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, `package source
+
+import (
+	"context"
+	"errors"
+)
+
+// User is a user
+type User struct {
+	First string
+}
+
+// Service does things
+type Service interface {
+	Delete(ctx context.Context, id string) error
+}
+
+type (
+	B struct{}
+)
+
+// Get returns a user
+func Get(ctx context.Context) (User, error) {
+	return User{}, errors.New("not implemented")
+}
+`, out)
+
+	assert.NoError(t, src.RemoveInterface("Service"))
+	assert.NoError(t, src.RemoveFunction("Get"))
+	assert.NoError(t, src.RemoveImport("errors"))
+	assert.NoError(t, src.RemoveImport("context"))
+	assert.NoError(t, src.RemoveStructure("User"))
+
+	out, err = src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, `package source
+
+type (
+	B struct{}
+)
+`, out)
+}
+
+func TestSourceRenameAndReplace(t *testing.T) {
+	src, err := New(`package source
+
+type User struct {
+	Name string
+}
+
+type Service interface {
+	Get(id string) (*User, error)
+}
+
+func (u *User) Greeting() string {
+	return "hello " + u.Name
+}
+
+func NewUser(name string) *User {
+	u := &User{Name: name}
+	return u
+}
+
+func handle(svc Service) string {
+	user, _ := svc.Get("1")
+	other := NewUser("other")
+	return user.Greeting() + other.Greeting()
+}
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, src.RenameField("User", "Name", "FullName"))
+	assert.NoError(t, src.RenameStructure("User", "Account"))
+	assert.NoError(t, src.RenameFunction("NewUser", "NewAccount"))
+	assert.NoError(t, src.RenameFunction("Account.Greeting", "Hello"))
+	assert.NoError(t, src.RenameInterfaceMethod("Service", "Get", "Find"))
+
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, `package source
+
+type Account struct {
+	FullName string
+}
+
+type Service interface {
+	Find(id string) (*Account, error)
+}
+
+func (u *Account) Hello() string {
+	return "hello " + u.FullName
+}
+
+func NewAccount(name string) *Account {
+	u := &Account{FullName: name}
+	return u
+}
+
+func handle(svc Service) string {
+	user, _ := svc.Find("1")
+	other := NewAccount("other")
+	return user.Hello() + other.Hello()
+}
+`, out)
+
+	// the new name can not be declared already
+	err = src.RenameStructure("Account", "Service")
+	assert.True(t, errors.Is(err, &UnsupportedError{Op: "RenameStructure", Name: "Account"}))
+	assert.True(t, errors.Is(src.RenameFunction("NewAccount", "handle"), ErrUnsupported))
+	assert.True(t, errors.Is(src.RenameField("Account", "FullName", "Hello"), ErrUnsupported))
+	assert.NoError(t, src.RenameInterfaceMethod("Service", "Find", "Find"))
+
+	account, err := src.GetStructure("Account")
+	assert.NoError(t, err)
+	st := account.Struct()
+	st.Fields = append(st.Fields, *code.NewStructField("Age", code.Type{Qualifier: "int"}))
+	assert.NoError(t, src.ReplaceStructure("Account", *st))
+	account, err = src.GetStructure("Account")
+	assert.NoError(t, err)
+	assert.Len(t, account.Fields(), 2)
+
+	assert.NoError(t, src.ReplaceFunction("handle", *code.NewFunction("handle")))
+	handle, err := src.GetFunction("handle")
+	assert.NoError(t, err)
+	assert.Len(t, handle.Params(), 0)
+
+	// the types of values from other packages are not known so their selectors can not be renamed
+	src, err = New(`package source
+
+import "example.com/lib"
+
+type Conn struct{}
+
+func (c Conn) Close() error {
+	return nil
+}
+
+func run() {
+	c := lib.Dial()
+	c.Close()
+}
+`, WithBuildContext(testBuildContext{}))
+	assert.NoError(t, err)
+	var unsupported *UnsupportedError
+	assert.True(t, errors.As(src.RenameFunction("Conn.Close", "Stop"), &unsupported))
+	assert.Contains(t, unsupported.Reason, "file.go:13:4")
+}
+
+func TestSourceDeclarationOrder(t *testing.T) {
+	src, err := New(`package source
+
+const Version = "1"
+
+type Zeta struct{}
+
+type Alpha struct{}
+
+type Middle interface{}
+
+func (z Zeta) B() {}
+
+func (z Zeta) A() {}
+
+var defaultZeta = Zeta{}
+
+type ID string
+
+func init() {}
+`)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		var names []string
+		for _, st := range src.Structures() {
+			names = append(names, st.Name())
+		}
+		assert.Equal(t, []string{"Zeta", "Alpha"}, names)
+	}
+	zeta, err := src.GetStructure("Zeta")
+	assert.NoError(t, err)
+	assert.Equal(t, "B", zeta.Methods()[0].Name())
+
+	var kinds []DeclKind
+	var names []string
+	for _, d := range src.Decls() {
+		kinds = append(kinds, d.Kind)
+		names = append(names, d.Node.Name())
+	}
+	assert.Equal(t, []DeclKind{
+		ConstantDecl, StructureDecl, StructureDecl, InterfaceDecl, FunctionDecl,
+		FunctionDecl, VariableDecl, NamedTypeDecl, FunctionDecl,
+	}, kinds)
+	assert.Equal(t, []string{"Version", "Zeta", "Alpha", "Middle", "B", "A", "defaultZeta", "ID", "init"}, names)
+}
+
+func TestSourceDiagnostics(t *testing.T) {
+	code := `package source
+
+type User struct {
+	Name string ` + "`json:\"name\" db:name`" + `
+}
+
+func init() {}
+
+func init() {}
+
+func Get() {}
+
+func Get() {}
+`
+	src, err := New(code)
+	assert.NoError(t, err)
+	diagnostics := src.Diagnostics()
+	assert.Len(t, diagnostics, 2)
+	assert.Equal(t, "field tag", diagnostics[0].Kind)
+	assert.Equal(t, "Name", diagnostics[0].Name)
+	assert.Equal(t, 4, diagnostics[0].Position.Line)
+	assert.Equal(t, "function", diagnostics[1].Kind)
+	assert.Equal(t, "Get", diagnostics[1].Name)
+	assert.Equal(t, 13, diagnostics[1].Position.Line)
+	user, err := src.GetStructure("User")
+	assert.NoError(t, err)
+	assert.Equal(t, "name", (*user.Fields()[0].code.Tags)["json"])
+
+	_, err = New(code, WithStrict())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "4:")
+	assert.Contains(t, err.Error(), "malformed struct tag (and 1 more)")
+}
+
+func TestSourceFieldTags(t *testing.T) {
+	src, err := New("package source\n\ntype User struct {\n\tID   string `json:\"id,omitempty\"   yaml:\"id\"`\n\tName string\n\tHTTPServerURL string\n\tage  int\n}\n")
+	assert.NoError(t, err)
+	out := func() string {
+		s, err := src.String()
+		assert.NoError(t, err)
+		return s
+	}
+
+	assert.NoError(t, src.SetFieldTag("User", "ID", "db", "id"))
+	assert.NoError(t, src.SetFieldTag("User", "ID", "yaml", "identifier"))
+	assert.NoError(t, src.SetFieldTags("User", "Name", code.FieldTags{"json": "name", "db": "name"}))
+	assert.Contains(t, out(), "`json:\"id,omitempty\" yaml:\"identifier\" db:\"id\"`")
+	assert.Contains(t, out(), "Name          string `db:\"name\" json:\"name\"`")
+
+	assert.NoError(t, src.RemoveFieldTag("User", "Name", "db"))
+	assert.NoError(t, src.RemoveFieldTag("User", "Name", "json"))
+	assert.Contains(t, out(), "Name          string\n")
+	assert.True(t, errors.Is(src.RemoveFieldTag("User", "Name", "json"), &NotFoundError{Kind: "tag"}))
+
+	assert.NoError(t, src.AddFieldTags("User", SnakeCase, "json", "db"))
+	assert.Contains(t, out(), "HTTPServerURL string `json:\"http_server_url\" db:\"http_server_url\"`")
+	assert.Contains(t, out(), "`json:\"id,omitempty\" yaml:\"identifier\" db:\"id\"`")
+	assert.Contains(t, out(), "age           int\n")
+
+	user, err := src.GetStructure("User")
+	assert.NoError(t, err)
+	assert.Equal(t, "name", user.Fields()[1].Tags()["json"])
+	assert.Equal(t, "httpServerUrl", CamelCase.Name("HTTPServerURL"))
+	assert.Equal(t, "user-id", KebabCase.Name("UserID"))
+
+	// fields declared together are split so every field has its own tag
+	src, err = New("package source\n\ntype Person struct {\n\t// names of the person\n\tFirst, Last, middle string // required\n}\n")
+	assert.NoError(t, err)
+	assert.NoError(t, src.AddFieldTags("Person", SnakeCase, "json"))
+	assert.Equal(t, "package source\n\ntype Person struct {\n\t// names of the person\n\tFirst  string `json:\"first\"`\n\tLast   string `json:\"last\"`\n\tmiddle string // required\n}\n", out())
+	person, err := src.GetStructure("Person")
+	assert.NoError(t, err)
+	assert.Equal(t, "last", person.Fields()[1].Tags()["json"])
+}
+
+func TestSourceImports(t *testing.T) {
+	src, err := New(`package source
+
+import "fmt" // for printing
+
+var errors = 1
+
+func Print() {
+	fmt.Println(errors)
+}
+`, WithBuildContext(testBuildContext{}))
+	assert.NoError(t, err)
+	out := func() string {
+		s, err := src.String()
+		assert.NoError(t, err)
+		return s
+	}
+
+	name, err := src.AppendImport(code.Import{Path: "fmt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "fmt", name)
+
+	name, err = src.AppendImport(code.Import{Path: "github.com/go-errors/errors"})
+	assert.NoError(t, err)
+	assert.Equal(t, "errors2", name)
+	name, err = src.AppendImport(code.Import{Path: "github.com/pkg/errors"})
+	assert.NoError(t, err)
+	assert.Equal(t, "errors3", name)
+	name, err = src.AppendImport(code.Import{Path: "gopkg.in/yaml.v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml", name)
+	name, err = src.AppendImport(code.Import{Alias: "_", Path: "github.com/lib/pq"})
+	assert.NoError(t, err)
+	assert.Equal(t, "_", name)
+	assert.Contains(t, out(), `import (
+	"fmt" // for printing
+	errors2 "github.com/go-errors/errors"
+	_ "github.com/lib/pq"
+	errors3 "github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)`)
+
+	// the package name of yaml.v2 is only guessed so it is kept
+	assert.NoError(t, src.RemoveUnusedImports())
+	assert.Contains(t, out(), `import (
+	"fmt" // for printing
+	_ "github.com/lib/pq"
+	"gopkg.in/yaml.v2"
+)`)
+
+	// aliases do not shadow the parameters and local variables of functions
+	src, err = New(`package source
+
+import "example.com/go-lib"
+
+func Load(yaml string) {
+	json := yaml
+	lib.Load(json)
+}
+`, WithBuildContext(MapBuildContext{Packages: map[string]ImportInfo{
+		"example.com/go-lib": {Dir: "/lib", Name: "lib"},
+		"encoding/json":      {Dir: "/json", Name: "json"},
+		"gopkg.in/yaml.v2":   {Dir: "/yaml", Name: "yaml"},
+	}}))
+	assert.NoError(t, err)
+	name, err = src.AppendImport(code.Import{Path: "gopkg.in/yaml.v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml2", name)
+	name, err = src.AppendImport(code.Import{Path: "encoding/json"})
+	assert.NoError(t, err)
+	assert.Equal(t, "json2", name)
+	assert.NoError(t, src.RemoveUnusedImports())
+	assert.Contains(t, out(), `import (
+	"example.com/go-lib"
+)`)
+}
+
+type testBuildContext struct{}
+
+func (testBuildContext) Import(path string) (*ImportInfo, error) {
+	return nil, os.ErrNotExist
+}
+
+func (testBuildContext) Cwd() (string, error) {
+	return os.Getwd()
+}
+
+func TestSourceOrganizeImports(t *testing.T) {
+	code := `package source
+
+// imports
+import (
+	"github.com/go-services/source/internal" // local
+	"github.com/go-errors/errors"
+	// formatting
+	"fmt"
+)
+
+import "os"
+
+import jen "github.com/dave/jennifer/jen"
+
+var _ = []interface{}{internal.X, errors.New, fmt.Println, os.Exit, jen.Id}
+`
+	expected := `// imports
+import (
+	// formatting
+	"fmt"
+	"os"
+
+	jen "github.com/dave/jennifer/jen"
+	"github.com/go-errors/errors"
+
+	"github.com/go-services/source/internal" // local
+)
+
+var _`
+	src, err := New(code, WithOrganizeImports(ImportOptions{}))
+	assert.NoError(t, err)
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Contains(t, out, expected)
+	// formatting does not change the source
+	assert.Equal(t, code, src.file.src)
+
+	src, err = New(code)
+	assert.NoError(t, err)
+	assert.NoError(t, src.OrganizeImports(ImportOptions{LocalPrefix: "github.com/go-errors"}))
+	out, err = src.String()
+	assert.NoError(t, err)
+	assert.Contains(t, out, `	"os"
+
+	jen "github.com/dave/jennifer/jen"
+	"github.com/go-services/source/internal" // local
+
+	"github.com/go-errors/errors"
+)`)
+	assert.Len(t, src.Imports(), 5)
+}
+
+func TestSourceImportCache(t *testing.T) {
+	ctx := &countingBuildContext{}
+	cache := NewImportCache()
+	file := `package source
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type User struct{}
+`
+	src, err := New(file, WithBuildContext(ctx), WithImportCache(cache), WithFullReparse())
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("F"+string(rune('A'+i)), code.Type{Qualifier: "string"})))
+	}
+	assert.Equal(t, 3, ctx.imports)
+	assert.Equal(t, 3, cache.Misses())
+	assert.Equal(t, 30, cache.Hits())
+
+	_, err = src.AppendImport(code.Import{Path: "bytes"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, ctx.imports)
+
+	// the cache is shared with other sources
+	_, err = New(file, WithBuildContext(ctx), WithImportCache(cache))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, ctx.imports)
+	assert.Equal(t, cache, src.ImportCache())
+
+	// the packages are cached for every build context and errors are not cached
+	mapCtx := MapBuildContext{Packages: map[string]ImportInfo{}}
+	info, err := cache.Import(mapCtx, "example.com/lib")
+	assert.Error(t, err)
+	assert.Nil(t, info)
+	mapCtx.Packages["example.com/lib"] = ImportInfo{Dir: "/lib", Name: "lib"}
+	info, err = cache.Import(mapCtx, "example.com/lib")
+	assert.NoError(t, err)
+	assert.Equal(t, "lib", info.Name)
+	info, err = cache.Import(mapCtx, "fmt")
+	assert.Error(t, err)
+	info, err = cache.Import(ctx, "fmt")
+	assert.NoError(t, err)
+	assert.Equal(t, "fmt", info.Name)
+}
+
+type countingBuildContext struct {
+	imports int
+}
+
+func (c *countingBuildContext) Import(path string) (*ImportInfo, error) {
+	c.imports++
+	return &ImportInfo{Name: path}, nil
+}
+
+func (c *countingBuildContext) Cwd() (string, error) {
+	return os.Getwd()
+}
+
+func TestSourceDiff(t *testing.T) {
+	file := `package source
+
+type User struct {
+	ID string
+}
+
+// Service gets users
+type Service interface {
+	Get(id string) (User, error)
+}
+
+func Print() {}
+`
+	src, err := New(file)
+	assert.NoError(t, err)
+	diff, err := src.Diff()
+	assert.NoError(t, err)
+	assert.Equal(t, "", diff)
+	edits, err := src.Edits()
+	assert.NoError(t, err)
+	assert.Len(t, edits, 0)
+
+	assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("Name", code.Type{Qualifier: "string"})))
+	assert.NoError(t, src.RemoveFunction("Print"))
+	diff, err = src.Diff()
+	assert.NoError(t, err)
+	assert.Equal(t, `--- file.go
++++ file.go
+@@ -2,6 +2,7 @@
+ 
+ type User struct {
+ 	ID string
++	Name string
+ }
+ 
+ // Service gets users
+@@ -9,4 +10,3 @@
+ 	Get(id string) (User, error)
+ }
+ 
+-func Print() {}
+`, diff)
+
+	edits, err = src.Edits()
+	assert.NoError(t, err)
+	assert.Len(t, edits, 2)
+	assert.Equal(t, TextEdit{Offset: 46, Length: 0, Text: "\tName string\n"}, edits[0])
+	applied := file
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		applied = applied[:e.Offset] + e.Text + applied[e.Offset+e.Length:]
+	}
+	assert.Equal(t, src.file.src, applied)
+
+	// the source is not formatted so a file that is not formatted has no changes without edits
+	src, err = New("package source\n\ntype User struct {\n\tID    string\n}\n")
+	assert.NoError(t, err)
+	diff, err = src.Diff()
+	assert.NoError(t, err)
+	assert.Equal(t, "", diff)
+	edits, err = src.Edits()
+	assert.NoError(t, err)
+	assert.Len(t, edits, 0)
+}
+
+func TestSourceMinimalEdits(t *testing.T) {
+	file := `package source
+
+import "fmt" // print
+
+
+// User is   formatted by hand
+type User struct {
+	ID string   ` + "`json:\"id\"`" + `
+	Name      string
+}
+
+type Account struct {
+	ID string
+	Owner   User
+}
+
+
+
+func Print(u User)  {
+	fmt.Println(u)
+}
+
+func Delete() {}
+`
+	src, err := New(file, WithMinimalEdits())
+	assert.NoError(t, err)
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, file, out)
+
+	assert.NoError(t, src.AppendFieldToStruct("Account", code.NewStructField("Balance", code.Type{Qualifier: "int"})))
+	_, err = src.AppendImport(code.Import{Path: "strings"})
+	assert.NoError(t, err)
+	assert.NoError(t, src.RemoveFunction("Delete"))
+	out, err = src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, `package source
+
+import (
+	"fmt" // print
+	"strings"
+)
+
+
+// User is   formatted by hand
+type User struct {
+	ID string   `+"`json:\"id\"`"+`
+	Name      string
+}
+
+type Account struct {
+	ID      string
+	Owner   User
+	Balance int
+}
+
+
+
+func Print(u User)  {
+	fmt.Println(u)
+}
+`, out)
+
+	// the diff shows the source as it was edited, before the changed declarations are formatted
+	diff, err := src.Diff()
+	assert.NoError(t, err)
+	assert.Equal(t, `--- file.go
++++ file.go
+@@ -1,6 +1,9 @@
+ package source
+ 
+-import "fmt" // print
++import (
++	"fmt" // print
++	"strings"
++)
+ 
+ 
+ // User is   formatted by hand
+@@ -12,6 +15,7 @@
+ type Account struct {
+ 	ID string
+ 	Owner   User
++	Balance int
+ }
+ 
+ 
+@@ -20,4 +24,3 @@
+ 	fmt.Println(u)
+ }
+ 
+-func Delete() {}
+`, diff)
+}
@@ -0,0 +1,264 @@
+package source
+
+import (
+	"go/ast"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-services/code"
+)
+
+// TagNaming is the naming strategy used to generate tag values from field names.
+type TagNaming int
+
+const (
+	// SnakeCase names the field `UserID` as `user_id`
+	SnakeCase TagNaming = iota
+	// CamelCase names the field `UserID` as `userId`
+	CamelCase
+	// KebabCase names the field `UserID` as `user-id`
+	KebabCase
+)
+
+// Name returns the tag value of the field name.
+func (n TagNaming) Name(field string) string {
+	words := splitWords(field)
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if n == CamelCase && i > 0 {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		words[i] = w
+	}
+	switch n {
+	case CamelCase:
+		return strings.Join(words, "")
+	case KebabCase:
+		return strings.Join(words, "-")
+	}
+	return strings.Join(words, "_")
+}
+
+// tagPair is a single key of a struct tag, quoted is the value as it is written in the source.
+type tagPair struct {
+	key    string
+	value  string
+	quoted string
+}
+
+// SetFieldTag sets the value of the tag key on the structure field e.x `json` and `name,omitempty`,
+// the other keys keep their order and formatting and new keys are added at the end.
+// Fields declared together e.x `A, B string` share their tag.
+func (s *Source) SetFieldTag(name, field, key, value string) error {
+	return s.SetFieldTags(name, field, code.FieldTags{key: value})
+}
+
+// SetFieldTags sets the values of the tag keys on the structure field, keys that are not
+// given are kept and new keys are added at the end sorted by key.
+func (s *Source) SetFieldTags(name, field string, tags code.FieldTags) error {
+	f, err := s.structureField(name, field)
+	if err != nil {
+		return err
+	}
+	list := fieldTagList(f)
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		list = setTag(list, k, tags[k])
+	}
+	s.file.src = replaceFieldTag(s.file.src, f, list)
+	return s.parseAgain("SetFieldTags")
+}
+
+// RemoveFieldTag removes the tag key from the structure field,
+// the tag is removed when it has no keys left.
+func (s *Source) RemoveFieldTag(name, field, key string) error {
+	f, err := s.structureField(name, field)
+	if err != nil {
+		return err
+	}
+	list := fieldTagList(f)
+	for i, t := range list {
+		if t.key != key {
+			continue
+		}
+		list = append(list[:i], list[i+1:]...)
+		s.file.src = replaceFieldTag(s.file.src, f, list)
+		return s.parseAgain("RemoveFieldTag")
+	}
+	return &NotFoundError{Kind: "tag", Name: key, ParentKind: "field", Parent: field}
+}
+
+// AddFieldTags adds the tag keys e.x `json` and `db` to every exported field of the structure
+// using the naming strategy, keys that a field already has are not changed and embedded fields are skipped.
+// Fields declared together e.x `First, Last string` share their tag, so they are split into one field per name.
+func (s *Source) AddFieldTags(name string, naming TagNaming, keys ...string) error {
+	structure, err := s.GetStructure(name)
+	if err != nil {
+		return err
+	}
+	edited := map[*ast.Field]bool{}
+	fields := structure.Fields()
+	// edit from the last field so the positions of the previous fields stay valid
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := fields[i]
+		if f.Embedded() || edited[f.ast] {
+			continue
+		}
+		edited[f.ast] = true
+		changed := false
+		lists := make([][]tagPair, len(f.ast.Names))
+		for j, n := range f.ast.Names {
+			lists[j] = fieldTagList(f)
+			if !ast.IsExported(n.Name) {
+				continue
+			}
+			for _, k := range keys {
+				if tagIndex(lists[j], k) < 0 {
+					lists[j] = setTag(lists[j], k, naming.Name(n.Name))
+					changed = true
+				}
+			}
+		}
+		switch {
+		case !changed:
+		case len(lists) > 1:
+			s.file.src = splitField(s.file.src, f.ast, lists)
+		default:
+			s.file.src = replaceFieldTag(s.file.src, f, lists[0])
+		}
+	}
+	return s.parseAgain("AddFieldTags")
+}
+
+func (s *Source) structureField(name, field string) (StructureField, error) {
+	structure, err := s.GetStructure(name)
+	if err != nil {
+		return StructureField{}, err
+	}
+	for _, f := range structure.Fields() {
+		if f.Name() == field {
+			return f, nil
+		}
+	}
+	return StructureField{}, &NotFoundError{Kind: "field", Name: field, ParentKind: "structure", Parent: name}
+}
+
+// fieldTagList returns the ordered tag keys of the field.
+func fieldTagList(f StructureField) []tagPair {
+	if f.ast.Tag == nil {
+		return nil
+	}
+	tag, err := strconv.Unquote(f.ast.Tag.Value)
+	if err != nil {
+		return nil
+	}
+	list, _ := parseTagList(tag)
+	return list
+}
+
+func tagIndex(list []tagPair, key string) int {
+	for i, t := range list {
+		if t.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func setTag(list []tagPair, key, value string) []tagPair {
+	t := tagPair{key: key, value: value, quoted: strconv.Quote(value)}
+	if i := tagIndex(list, key); i >= 0 {
+		list[i] = t
+		return list
+	}
+	return append(list, t)
+}
+
+// formatTag returns the tag literal e.x "`json:\"name\" db:\"name\"`".
+func formatTag(list []tagPair) string {
+	parts := make([]string, len(list))
+	for i, t := range list {
+		parts[i] = t.key + ":" + t.quoted
+	}
+	tag := strings.Join(parts, " ")
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// replaceFieldTag replaces the tag of the field, the tag is removed if the list is empty.
+func replaceFieldTag(src string, f StructureField, list []tagPair) string {
+	if f.ast.Tag == nil {
+		if len(list) == 0 {
+			return src
+		}
+		end := int(f.ast.Type.End()) - 1
+		return src[:end] + " " + formatTag(list) + src[end:]
+	}
+	begin, end := int(f.ast.Tag.Pos())-1, int(f.ast.Tag.End())-1
+	if len(list) == 0 {
+		begin = int(f.ast.Type.End()) - 1
+		return src[:begin] + src[end:]
+	}
+	return src[:begin] + formatTag(list) + src[end:]
+}
+
+// splitField replaces a field that declares several names with one field per name,
+// every field gets the tag list at the index of its name.
+func splitField(src string, field *ast.Field, lists [][]tagPair) string {
+	begin := int(field.Names[0].Pos()) - 1
+	end := int(field.Type.End()) - 1
+	if field.Tag != nil {
+		end = int(field.Tag.End()) - 1
+	}
+	// the new fields use the indentation of the line the field starts on
+	indent := src[strings.LastIndex(src[:begin], "\n")+1 : begin]
+	indent = indent[:len(indent)-len(strings.TrimLeft(indent, " \t"))]
+	tp := src[field.Type.Pos()-1 : field.Type.End()-1]
+	lines := make([]string, len(field.Names))
+	for i, n := range field.Names {
+		lines[i] = n.Name + " " + tp
+		if len(lists[i]) > 0 {
+			lines[i] += " " + formatTag(lists[i])
+		}
+	}
+	return src[:begin] + strings.Join(lines, "\n"+indent) + src[end:]
+}
+
+// splitWords splits a field name into words, acronyms are kept together e.x `HTTPServerID` is split into
+// `HTTP`, `Server` and `ID`.
+func splitWords(name string) (words []string) {
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		if cur == '_' || cur == '-' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		lowerToUpper := (unicode.IsLower(prev) || unicode.IsDigit(prev)) && unicode.IsUpper(cur)
+		acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(cur) && unicode.IsLower(next)
+		if i > start && (lowerToUpper || acronymEnd) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
@@ -0,0 +1,135 @@
+package source
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TextEdit represents the replacement of Length bytes at Offset with Text.
+type TextEdit struct {
+	Offset int
+	Length int
+	Text   string
+}
+
+// Tx is a transaction that batches edits of a source.
+// The edit methods of the transaction are the edit methods of Source, but instead of parsing
+// the source after every edit they are recorded and applied together on Commit.
+// Every edit is computed against the source as it was when the transaction began,
+// so an edit can not depend on the result of a previous edit in the same transaction.
+type Tx struct {
+	*Source
+
+	// the source the transaction was started on
+	source *Source
+
+	// the recorded edits in the order they were made
+	edits []txEdit
+	done  bool
+}
+
+type txEdit struct {
+	op string
+	TextEdit
+}
+
+// Begin starts a transaction on the source, the source is not changed until the transaction is committed.
+func (s *Source) Begin() (*Tx, error) {
+	// the edits of the transaction are not parsed so the source must be resolved before it begins
+	if err := s.resolve(); err != nil {
+		return nil, err
+	}
+	tx := &Tx{source: s}
+	cp := *s
+	cp.tx = tx
+	tx.Source = &cp
+	return tx, nil
+}
+
+// Batch runs fn in a transaction, if fn returns an error the transaction is rolled back
+// otherwise it is committed.
+func (s *Source) Batch(fn func(tx *Tx) error) error {
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// record stores the change made by an edit operation as a text edit.
+func (tx *Tx) record(op, before, after string) {
+	tx.edits = append(tx.edits, txEdit{
+		op:       op,
+		TextEdit: diffEdit(before, after),
+	})
+}
+
+// Commit applies every recorded edit and parses the source once,
+// if the edits overlap or produce invalid code the source is left unchanged.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	if len(tx.edits) == 0 {
+		return nil
+	}
+	if tx.source.file != tx.Source.file {
+		return ErrTxStale
+	}
+	src, err := applyEdits(tx.source.file.src, tx.edits)
+	if err != nil {
+		return err
+	}
+	tx.source.file.src = src
+	return tx.source.parseAgain("Commit")
+}
+
+// Rollback discards the recorded edits.
+func (tx *Tx) Rollback() {
+	tx.done = true
+	tx.edits = nil
+}
+
+// applyEdits applies the edits starting from the end of the source so the offsets of the
+// remaining edits stay valid, insertions at the same offset keep the order they were made in.
+func applyEdits(src string, edits []txEdit) (string, error) {
+	sorted := make([]txEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].Offset+sorted[i-1].Length > sorted[i].Offset {
+			return "", fmt.Errorf("edits of `%s` and `%s` overlap", sorted[i-1].op, sorted[i].op)
+		}
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		e := sorted[i]
+		src = src[:e.Offset] + e.Text + src[e.Offset+e.Length:]
+	}
+	return src, nil
+}
+
+// diffEdit returns the single edit that changes before to after,
+// the common prefix and suffix of the two sources are left out of the edit.
+func diffEdit(before, after string) TextEdit {
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	return TextEdit{
+		Offset: prefix,
+		Length: len(before) - prefix - suffix,
+		Text:   after[prefix : len(after)-suffix],
+	}
+}
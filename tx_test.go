@@ -0,0 +1,142 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-services/code"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceBatch(t *testing.T) {
+	src, err := New(`package source
+
+type User struct {
+	ID string
+}
+
+type Service interface {
+	Get(id string) (User, error)
+}
+`)
+	assert.NoError(t, err)
+
+	err = src.Batch(func(tx *Tx) error {
+		for _, name := range []string{"First", "Last", "Email"} {
+			if err := tx.AppendFieldToStruct("User", code.NewStructField(name, code.Type{Qualifier: "string"})); err != nil {
+				return err
+			}
+		}
+		if err := tx.RemoveMethodFromInterface("Service", "Get"); err != nil {
+			return err
+		}
+		// edits are not visible until the transaction is committed
+		user, err := tx.GetStructure("User")
+		if err != nil {
+			return err
+		}
+		assert.Len(t, user.Fields(), 1)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	user, err := src.GetStructure("User")
+	assert.NoError(t, err)
+	assert.Len(t, user.Fields(), 4)
+	assert.Equal(t, "Last", user.Fields()[2].Name())
+	inf, err := src.GetInterface("Service")
+	assert.NoError(t, err)
+	assert.Len(t, inf.Methods(), 0)
+
+	before := src.file.src
+	err = src.Batch(func(tx *Tx) error {
+		if err := tx.AppendFieldToStruct("User", code.NewStructField("Age", code.Type{Qualifier: "int"})); err != nil {
+			return err
+		}
+		return fmt.Errorf("something went wrong")
+	})
+	assert.EqualError(t, err, "something went wrong")
+	assert.Equal(t, before, src.file.src)
+
+	tx, err := src.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, tx.AppendFieldToStruct("User", code.NewStructField("Age", code.Type{Qualifier: "int"})))
+	assert.NoError(t, tx.AppendStructure(*code.NewStructWithFields("Broken{", nil)))
+	err = tx.Commit()
+	var editErr *EditError
+	assert.True(t, errors.As(err, &editErr))
+	assert.Equal(t, before, src.file.src)
+	assert.Equal(t, ErrTxDone, tx.Commit())
+	user, err = src.GetStructure("User")
+	assert.NoError(t, err)
+	assert.Len(t, user.Fields(), 4)
+}
+
+func TestSourceBatchRename(t *testing.T) {
+	src, err := New(`package source
+
+type User struct {
+	ID string
+}
+
+func (u *User) Get() {}
+
+type Service interface {
+	Get(id string) error
+}
+`)
+	assert.NoError(t, err)
+	assert.NoError(t, src.AppendFieldToStruct("User", code.NewStructField("Name", code.Type{Qualifier: "string"})))
+	assert.True(t, src.file.incremental)
+
+	err = src.Batch(func(tx *Tx) error {
+		if err := tx.AppendMethodToInterface("Service", code.NewInterfaceMethod("List")); err != nil {
+			return err
+		}
+		return tx.RenameStructure("User", "Account")
+	})
+	assert.NoError(t, err)
+	_, err = src.GetStructure("Account")
+	assert.NoError(t, err)
+	get, err := src.GetMethod("Account", "Get")
+	assert.NoError(t, err)
+	assert.Equal(t, "Account", get.ReceiverType())
+	inf, err := src.GetInterface("Service")
+	assert.NoError(t, err)
+	assert.Len(t, inf.Methods(), 2)
+}
+
+func TestSourceBatchRemoveUnusedImports(t *testing.T) {
+	src, err := New(`package source
+
+import "os"
+
+import (
+	"fmt"
+	"strings" // unused
+	str "strconv"
+)
+
+func Print() {
+	fmt.Println()
+}
+`)
+	assert.NoError(t, err)
+	err = src.Batch(func(tx *Tx) error {
+		return tx.RemoveUnusedImports()
+	})
+	assert.NoError(t, err)
+	out, err := src.String()
+	assert.NoError(t, err)
+	assert.Equal(t, `package source
+
+import (
+	"fmt"
+)
+
+func Print() {
+	fmt.Println()
+}
+`, out)
+}
@@ -1,9 +1,17 @@
 package source
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/dave/jennifer/jen"
 	"github.com/go-services/code"
@@ -20,9 +28,7 @@ func parseType(expr ast.Expr, imports []Import) *code.Type {
 	case *ast.SelectorExpr:
 		qual, ok := t.X.(*ast.Ident)
 		if !ok {
-			tp.RawType = &jen.Statement{}
-			parseComplexType(expr, tp.RawType)
-			return tp
+			return rawType(expr)
 		}
 		for _, i := range imports {
 			if i.code.Alias == qual.Name {
@@ -36,37 +42,29 @@ func parseType(expr ast.Expr, imports []Import) *code.Type {
 				return tp
 			}
 		}
-		tp.RawType = &jen.Statement{}
-		parseComplexType(expr, tp.RawType)
-		return tp
+		return rawType(expr)
 	case *ast.StarExpr:
 		tp = parseType(t.X, imports)
-		if tp.RawType == nil {
+		if tp.RawType == nil && !tp.Pointer {
 			tp.Pointer = true
 			return tp
 		}
-		tp.RawType = &jen.Statement{}
-		parseComplexType(expr, tp.RawType)
-		return tp
+		return rawType(expr)
 	case *ast.ArrayType:
+		if t.Len != nil {
+			// arrays with length e.x `[4]int` can not be represented with code
+			return rawType(expr)
+		}
 		innerType := parseType(t.Elt, imports)
 		if innerType.RawType == nil {
 			tp.ArrayType = innerType
 			return tp
 		}
-		innerType.RawType = &jen.Statement{}
-		parseComplexType(expr, innerType.RawType)
+		innerType.RawType = rawType(expr).RawType
 		return innerType
 	case *ast.MapType:
 		keyType := parseType(t.Key, imports)
 		valueType := parseType(t.Value, imports)
-		// not supported types
-		if keyType == nil {
-			return nil
-		}
-		if valueType == nil {
-			return nil
-		}
 		tp.MapType = &struct {
 			Key   code.Type
 			Value code.Type
@@ -74,8 +72,7 @@ func parseType(expr ast.Expr, imports []Import) *code.Type {
 			Key:   *keyType,
 			Value: *valueType,
 		}
-		tp.RawType = &jen.Statement{}
-		parseComplexType(expr, tp.RawType)
+		tp.RawType = rawType(expr).RawType
 		return tp
 	case *ast.FuncType:
 		fp := &functionParser{
@@ -89,16 +86,78 @@ func parseType(expr ast.Expr, imports []Import) *code.Type {
 		})
 		if err != nil {
 			// something could not be parsed
-			return nil
+			return rawType(expr)
 		}
 		tp.Function = &code.FunctionType{
 			Params:  fn.Params(),
 			Results: fn.Results(),
 		}
 		return tp
+	case *ast.ParenExpr:
+		return parseType(t.X, imports)
 	default:
-		return nil
+		// channels, variadic parameters, inline structures and interfaces, instantiated generic types
+		// e.x `Repo[User]` and union constraints e.x `~int | ~string` can not be represented with code
+		return rawType(expr)
+	}
+}
+
+// rawType represents the type using RawType, type expressions that can not be
+// built with jen statements are printed as they are written in the source.
+func rawType(expr ast.Expr) *code.Type {
+	tp := &code.Type{
+		RawType: &jen.Statement{},
+	}
+	if !parseComplexType(expr, tp.RawType) {
+		tp.RawType = jen.Id(exprString(expr))
+	}
+	return tp
+}
+
+// exprString prints the expression the way gofmt would.
+func exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, token.NewFileSet(), expr); err != nil {
+		return ""
 	}
+	return buf.String()
+}
+
+// parseTypeParams parses the type parameter list of a generic type or function.
+func parseTypeParams(params *ast.FieldList, imports []Import) (list []TypeParam) {
+	if params == nil {
+		return list
+	}
+	for _, p := range params.List {
+		if p == nil {
+			continue
+		}
+		tp := parseType(p.Type, imports)
+		terms := parseTypeTerms(p.Type, imports)
+		for _, n := range p.Names {
+			list = append(list, TypeParam{
+				Name:       n.Name,
+				Constraint: *tp,
+				Terms:      terms,
+			})
+		}
+	}
+	return list
+}
+
+// parseTypeTerms flattens a constraint union e.x `~int | ~string` into its terms.
+// a constraint that is not a union is returned as a single term.
+func parseTypeTerms(expr ast.Expr, imports []Import) (terms []TypeTerm) {
+	for _, e := range unionTerms(expr) {
+		term := TypeTerm{}
+		if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.TILDE {
+			term.Tilde = true
+			e = u.X
+		}
+		term.Type = *parseType(e, imports)
+		terms = append(terms, term)
+	}
+	return terms
 }
 
 func parseComplexType(expr ast.Expr, statement *jen.Statement) bool {
@@ -124,8 +183,45 @@ func parseComplexType(expr ast.Expr, statement *jen.Statement) bool {
 		if !parseComplexType(t.Elt, qual) {
 			return false
 		}
-		statement.Index().Add(qual)
+		if t.Len == nil {
+			statement.Index().Add(qual)
+			return true
+		}
+		if _, ok := t.Len.(*ast.Ellipsis); ok {
+			statement.Index(jen.Op("...")).Add(qual)
+			return true
+		}
+		length := &jen.Statement{}
+		if lit, ok := t.Len.(*ast.BasicLit); ok {
+			length.Id(lit.Value)
+		} else if !parseComplexType(t.Len, length) {
+			return false
+		}
+		statement.Index(length).Add(qual)
 		return true
+	case *ast.ChanType:
+		value := &jen.Statement{}
+		if !parseComplexType(t.Value, value) {
+			return false
+		}
+		switch t.Dir {
+		case ast.RECV:
+			statement.Op("<-").Chan().Add(value)
+		case ast.SEND:
+			statement.Chan().Op("<-").Add(value)
+		default:
+			statement.Chan().Add(value)
+		}
+		return true
+	case *ast.Ellipsis:
+		elt := &jen.Statement{}
+		if !parseComplexType(t.Elt, elt) {
+			return false
+		}
+		statement.Op("...").Add(elt)
+		return true
+	case *ast.ParenExpr:
+		return parseComplexType(t.X, statement)
 	case *ast.MapType:
 		key := &jen.Statement{}
 		if !parseComplexType(t.Key, key) {
@@ -137,10 +233,68 @@ func parseComplexType(expr ast.Expr, statement *jen.Statement) bool {
 		}
 		statement.Map(key).Add(value)
 		return true
+	case *ast.IndexExpr:
+		base := &jen.Statement{}
+		if !parseComplexType(t.X, base) {
+			return false
+		}
+		index := &jen.Statement{}
+		if !parseComplexType(t.Index, index) {
+			return false
+		}
+		statement.Add(base).Types(index)
+		return true
+	case *ast.IndexListExpr:
+		base := &jen.Statement{}
+		if !parseComplexType(t.X, base) {
+			return false
+		}
+		var indices []jen.Code
+		for _, i := range t.Indices {
+			index := &jen.Statement{}
+			if !parseComplexType(i, index) {
+				return false
+			}
+			indices = append(indices, index)
+		}
+		statement.Add(base).Types(indices...)
+		return true
+	case *ast.UnaryExpr:
+		if t.Op != token.TILDE {
+			return false
+		}
+		qual := &jen.Statement{}
+		if !parseComplexType(t.X, qual) {
+			return false
+		}
+		statement.Op("~").Add(qual)
+		return true
+	case *ast.BinaryExpr:
+		if t.Op != token.OR {
+			return false
+		}
+		var terms []jen.Code
+		for _, e := range unionTerms(t) {
+			term := &jen.Statement{}
+			if !parseComplexType(e, term) {
+				return false
+			}
+			terms = append(terms, term)
+		}
+		statement.Union(terms...)
+		return true
 	}
 	return false
 }
 
+// unionTerms returns the flat list of expressions in a union e.x `A | B | C`.
+func unionTerms(expr ast.Expr) []ast.Expr {
+	if b, ok := expr.(*ast.BinaryExpr); ok && b.Op == token.OR {
+		return append(unionTerms(b.X), unionTerms(b.Y)...)
+	}
+	return []ast.Expr{expr}
+}
+
 func cleanComment(comment string) string {
 	comment = strings.TrimPrefix(comment, "//")
 	comment = strings.TrimPrefix(comment, "/*")
@@ -162,6 +316,459 @@ func parseComments(docs *ast.CommentGroup) (dc []code.Comment) {
 	return
 }
 
+// embeddedFieldName returns the implicit name of an embedded field, that is the type name
+// without pointer, package and type arguments e.x `Reader` for `*io.Reader`.
+func embeddedFieldName(expr ast.Expr) string {
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	if star, ok := expr.(*ast.StarExpr); ok {
+		return embeddedFieldName(star.X)
+	}
+	return receiverTypeName(expr)
+}
+
+// methodSet returns the methods of the interface together with the methods of the interfaces it embeds,
+// embedded interfaces are looked up using get. The names of the embeds that can not be found
+// e.x `io.Closer` are returned, type elements e.x `~int | ~string` have no methods and are skipped.
+func methodSet(inf *Interface, get func(name string) (*Interface, error), visited map[string]bool) ([]InterfaceMethod, []string) {
+	visited[inf.Name()] = true
+	methods := append([]InterfaceMethod{}, inf.methods...)
+	var unresolved []string
+	for _, e := range inf.embeds {
+		if e.RawType != nil || e.Pointer || visited[e.Qualifier] {
+			continue
+		}
+		if e.Import != nil {
+			unresolved = append(unresolved, embedName(e))
+			continue
+		}
+		if e.Qualifier == "error" {
+			methods = append(methods, errorMethod())
+			continue
+		}
+		embedded, err := get(e.Qualifier)
+		if err != nil {
+			unresolved = append(unresolved, e.Qualifier)
+			continue
+		}
+		embeddedMethods, embeddedUnresolved := methodSet(embedded, get, visited)
+		methods = append(methods, embeddedMethods...)
+		unresolved = append(unresolved, embeddedUnresolved...)
+	}
+	// methods of embedded interfaces can overlap
+	seen := map[string]bool{}
+	var unique []InterfaceMethod
+	for _, m := range methods {
+		if !seen[m.Name()] {
+			seen[m.Name()] = true
+			unique = append(unique, m)
+		}
+	}
+	return unique, unresolved
+}
+
+// resolvedMethodSet returns the method set of the interface and an error listing the embeds that can not be resolved.
+func resolvedMethodSet(inf *Interface, get func(name string) (*Interface, error)) ([]InterfaceMethod, error) {
+	methods, unresolved := methodSet(inf, get, map[string]bool{})
+	if len(unresolved) > 0 {
+		return methods, &UnresolvedEmbedsError{Interface: inf.Name(), Embeds: unresolved}
+	}
+	return methods, nil
+}
+
+// embedName returns the name of an embedded interface as it is written e.x `io.Closer`.
+func embedName(e code.Type) string {
+	if e.Import == nil {
+		return e.Qualifier
+	}
+	pkg := e.Import.Alias
+	if pkg == "" {
+		pkg = defaultImportName(e.Import.Path)
+	}
+	return pkg + "." + e.Qualifier
+}
+
+// errorMethod returns the method of the predeclared `error` interface.
+func errorMethod() InterfaceMethod {
+	return InterfaceMethod{
+		exported: true,
+		code: code.NewInterfaceMethod(
+			"Error",
+			code.ResultsFunctionOption(*code.NewParameter("", code.Type{Qualifier: "string"})),
+		),
+	}
+}
+
+// receiverTypeName returns the name of the receiver type without pointer and type parameters.
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	}
+	return ""
+}
+
+// functionKey returns the key of a function in the file, methods are prefixed with the receiver type.
+func functionKey(receiverType, name string) string {
+	if receiverType == "" {
+		return name
+	}
+	return receiverType + "." + name
+}
+
+// valueCode creates the code of a constant or variable declaration e.x `const A int = 1`.
+func valueCode(statement *jen.Statement, name string, tp *code.Type, value string) *jen.Statement {
+	statement.Id(name)
+	if tp != nil {
+		statement.Add(tp.Code())
+	}
+	if value != "" {
+		statement.Op("=").Id(value)
+	}
+	return statement
+}
+
+// valueSpecCode returns the source line of a constant or variable specification.
+func valueSpecCode(name string, tp *code.Type, value string) string {
+	line := name
+	if tp != nil {
+		line += " " + tp.String()
+	}
+	if value != "" {
+		line += " = " + value
+	}
+	return line
+}
+
+// usesIota returns true if the expression references `iota`.
+func usesIota(expr ast.Expr) (found bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "iota" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// removeCode removes the code between begin and end, if the code occupies whole lines
+// the lines are removed as well so no blank lines are left behind.
+func removeCode(src string, begin, end int) string {
+	lineBegin := begin
+	for lineBegin > 0 && (src[lineBegin-1] == ' ' || src[lineBegin-1] == '\t') {
+		lineBegin--
+	}
+	lineEnd := end
+	for lineEnd < len(src) && (src[lineEnd] == ' ' || src[lineEnd] == '\t') {
+		lineEnd++
+	}
+	if (lineBegin == 0 || src[lineBegin-1] == '\n') && (lineEnd == len(src) || src[lineEnd] == '\n') {
+		begin, end = lineBegin, lineEnd
+		if end < len(src) {
+			end++
+		}
+		// do not leave two blank lines where the code used to be
+		if (begin == 0 || strings.HasSuffix(src[:begin], "\n\n")) && strings.HasPrefix(src[end:], "\n") {
+			end++
+		}
+	}
+	return src[:begin] + src[end:]
+}
+
+// appendSpecToGroup adds a specification line at the end of a grouped declaration,
+// a declaration that is not grouped is converted to a group.
+func appendSpecToGroup(src string, decl *ast.GenDecl, line string) string {
+	if decl.Lparen == token.NoPos {
+		specBegin := int(decl.Specs[0].Pos()) - 1
+		pre := src[:specBegin] + "(\n\t"
+		mid := src[specBegin:decl.End()-1] + "\n\t" + line + "\n)"
+		end := src[decl.End()-1:]
+		return fmt.Sprintf("%s%s%s", pre, mid, end)
+	}
+	pre := strings.TrimRight(src[:decl.Rparen-1], " \t\n") + "\n"
+	mid := "\t" + line + "\n"
+	end := src[decl.Rparen-1:]
+	return fmt.Sprintf("%s%s%s", pre, mid, end)
+}
+
+// removeSpec removes a specification together with its comments from a declaration,
+// if the specification is the only one in the declaration the whole declaration is removed.
+func removeSpec(src string, decl *ast.GenDecl, spec ast.Spec) string {
+	doc, comment := specComments(spec)
+	if len(decl.Specs) == 1 {
+		begin := decl.Pos()
+		if decl.Doc != nil {
+			begin = decl.Doc.Pos()
+		}
+		end := decl.End()
+		if comment != nil && comment.End() > end {
+			end = comment.End()
+		}
+		return removeCode(src, int(begin)-1, int(end)-1)
+	}
+	begin := spec.Pos()
+	if doc != nil {
+		begin = doc.Pos()
+	}
+	end := spec.End()
+	if comment != nil {
+		end = comment.End()
+	}
+	return removeCode(src, int(begin)-1, int(end)-1)
+}
+
+// removeSpecs removes the specifications of the declaration, the declaration is removed
+// if none of its specifications are left.
+func removeSpecs(src string, decl *ast.GenDecl, specs []ast.Spec) string {
+	if len(specs) == len(decl.Specs) {
+		begin := decl.Pos()
+		if decl.Doc != nil {
+			begin = decl.Doc.Pos()
+		}
+		end := decl.End()
+		if _, comment := specComments(specs[len(specs)-1]); comment != nil && comment.End() > end {
+			end = comment.End()
+		}
+		return removeCode(src, int(begin)-1, int(end)-1)
+	}
+	for i := len(specs) - 1; i >= 0; i-- {
+		src = removeSpec(src, decl, specs[i])
+	}
+	return src
+}
+
+// replaceSpec replaces a type specification together with its doc comments with the given type declaration,
+// inside grouped declarations the `type` keyword of the declaration is dropped.
+func replaceSpec(src string, decl *ast.GenDecl, spec ast.Spec, declaration string) string {
+	doc, _ := specComments(spec)
+	begin, end := spec.Pos(), spec.End()
+	if doc != nil {
+		begin = doc.Pos()
+	}
+	if decl.Lparen == token.NoPos {
+		begin, end = decl.Pos(), decl.End()
+		if decl.Doc != nil {
+			begin = decl.Doc.Pos()
+		}
+	} else {
+		lines := strings.Split(declaration, "\n")
+		for i, l := range lines {
+			if strings.HasPrefix(l, decl.Tok.String()+" ") {
+				lines[i] = strings.TrimPrefix(l, decl.Tok.String()+" ")
+				break
+			}
+		}
+		declaration = strings.Join(lines, "\n")
+	}
+	return src[:begin-1] + declaration + src[end-1:]
+}
+
+// specComments returns the doc and line comments of a specification.
+func specComments(spec ast.Spec) (doc, comment *ast.CommentGroup) {
+	switch s := spec.(type) {
+	case *ast.ValueSpec:
+		return s.Doc, s.Comment
+	case *ast.TypeSpec:
+		return s.Doc, s.Comment
+	case *ast.ImportSpec:
+		return s.Doc, s.Comment
+	}
+	return nil, nil
+}
+
+// removeField removes a field of a structure or a method of an interface together with its comments.
+func removeField(src string, field *ast.Field) string {
+	begin := field.Pos()
+	if field.Doc != nil {
+		begin = field.Doc.Pos()
+	}
+	end := field.End()
+	if field.Comment != nil {
+		end = field.Comment.End()
+	}
+	return removeCode(src, int(begin)-1, int(end)-1)
+}
+
+// removeListItem removes the item at index i from a comma separated list
+// e.x a parameter of a function or a name in `a, b int`.
+func removeListItem(src string, items []ast.Node, i int) string {
+	begin, end := items[i].Pos(), items[i].End()
+	if i+1 < len(items) {
+		end = items[i+1].Pos()
+	} else if i > 0 {
+		begin = items[i-1].End()
+	}
+	return src[:begin-1] + src[end-1:]
+}
+
+// importSpec returns the import specification e.x `"fmt"` or `errs "errors"`.
+func importSpec(alias, path string) string {
+	if alias == "" {
+		return strconv.Quote(path)
+	}
+	return alias + " " + strconv.Quote(path)
+}
+
+// defaultImportName guesses the package name of the import path when the package can not be found,
+// that is the last path element without the major version e.x `yaml` for `gopkg.in/yaml.v2`,
+// `sqlite3` for `github.com/mattn/go-sqlite3`, `nats` for `github.com/nats-io/nats.go`
+// and `chi` for `github.com/go-chi/chi/v5`.
+func defaultImportName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if strings.HasPrefix(path, "gopkg.in/") {
+		if i := strings.LastIndex(name, ".v"); i > 0 && isMajorVersion(name[i+1:]) {
+			name = name[:i]
+		}
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+	name = strings.TrimSuffix(name, ".go")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// isMajorVersion returns true for major version path elements e.x `v2`.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	for _, r := range elem[1:] {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// usedPackageNames returns the names used as package in selector expressions e.x `fmt` in `fmt.Println`,
+// identifiers that resolve to a declaration in the file are not packages.
+func usedPackageNames(file *ast.File) map[string]bool {
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		se, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := se.X.(*ast.Ident); ok && id.Obj == nil {
+			used[id.Name] = true
+		}
+		return true
+	})
+	return used
+}
+
+// identNames returns the names of the imports and the identifiers of the file e.x declarations,
+// parameters and local variables, the names after a selector e.x fields and methods are not included.
+func (s *Source) identNames() map[string]bool {
+	names := map[string]bool{}
+	for _, i := range s.file.imports {
+		names[i.Name()] = true
+	}
+	selected := map[*ast.Ident]bool{}
+	for _, d := range s.file.ast.Decls {
+		ast.Inspect(d, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				selected[n.Sel] = true
+			case *ast.Ident:
+				if !selected[n] {
+					names[n.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// fieldNames returns the names of the field separated by commas e.x `a, b`.
+func fieldNames(field *ast.Field) string {
+	names := make([]string, len(field.Names))
+	for i, n := range field.Names {
+		names[i] = n.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// nameIndex returns the index of the identifier with the given name.
+func nameIndex(names []*ast.Ident, name string) int {
+	for i, n := range names {
+		if n.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// identNodes converts identifiers to nodes so they can be used with removeListItem.
+func identNodes(names []*ast.Ident) (nodes []ast.Node) {
+	for _, n := range names {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// fieldNodes converts fields to nodes so they can be used with removeListItem.
+func fieldNodes(fields []*ast.Field) (nodes []ast.Node) {
+	for _, f := range fields {
+		nodes = append(nodes, f)
+	}
+	return nodes
+}
+
+// specIndex returns the index of the specification in the declaration.
+func specIndex(decl *ast.GenDecl, spec ast.Spec) int {
+	for i, s := range decl.Specs {
+		if s == spec {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory and renames it to path,
+// so readers never see a partially written file. The permissions of an existing file are kept.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 // this is used to add code to the body of a code node.
 // e.x to the body of a function, to the fields of a structure to the methods of an interface.
 func appendCodeToInner(src string, node NodeWithInner, c code.Code) string {